@@ -1,38 +1,83 @@
 package main
 
 import (
+	"cmp"
 	"fmt"
 	"log"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/aws/aws-cdk-go/awscdk/v2"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsdynamodb"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsec2"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsecs"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awslogs"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awssns"
 	"github.com/aws/constructs-go/constructs/v10"
 	"github.com/aws/jsii-runtime-go"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/capacity"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/notify"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/resolvers"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/wake"
 )
 
 type MinecraftServerStackProps struct {
 	awscdk.StackProps
-	UsEastLogGroupArn      string
+	UsEastLogGroupArn     string
+	QueryLogAlarmNames    []string
+	Route53Domain         string
+	Route53HostedZoneId   string
+	SnsSubscriptions      []SNSSubscription
+	LambdaWakeRecordTypes string
+	LambdaResolverFilter  ResolverFilterConfig
+	LambdaLearnResolvers  bool
+	LambdaWakeMode        wake.Mode
+	NotifyDiscordSecret   string
+	NotifySlackSecret     string
+	NotifyWebhookSecret   string
+	VpcEnableIPv6         bool
+
+	// Servers share the VPC, cluster, topic and launcher
+	Servers []ServerProps
+}
+
+// ServerProps holds the settings of a single server.
+type ServerProps struct {
+	// Name is the name of the server in MINECRAFT_SERVERS, empty if the
+	// variable is unset.
+	Name                   string
+	EcsCapacityMode        capacity.Mode
 	EcsCpuSize             string
 	EcsDebug               string
 	EcsMemorySize          string
 	EcsMinecraftEdition    string
 	EcsShutdownMin         string
+	EcsSessionStore        string
+	EcsShutdownWarnings    string
 	EcsStartupMin          string
-	Route53Domain          string
-	Route53HostedZoneId    string
-	Route53ServerSubDomain string
-	SnsEmail               string
 	EcsEnablePersistence   bool
+	Route53ParkingIP       string
+	Route53ServerSubDomain string
 
 	// Server configuration
 	MinecraftServerConfig ServerConfig
 }
 
+// ResolverFilterConfig holds the comma separated resolver rules of the launcher.
+type ResolverFilterConfig struct {
+	AllowCIDRs    string
+	DenyCIDRs     string
+	EdgeLocations string
+}
+
 type ServerConfig struct {
+	Edition                    string
 	Port                       int
+	RconPort                   int
+	QueryPort                  int
+	SrvPort                    int
 	Protocol                   awsecs.Protocol
 	Image                      string
 	Debug                      bool
@@ -75,105 +120,174 @@ func NewMinecraftServerStack(scope constructs.Construct, id string, props *Minec
 
 	stack := awscdk.NewStack(scope, &id, &sprops)
 
-	// Create VPC resources with a server-specific security group
+	// Create VPC resources with a security group open on the ports of all servers
+	var ingressRules []awsec2.Port
+	for _, server := range props.Servers {
+		ingressRules = append(ingressRules, server.MinecraftServerConfig.IngressPort)
+	}
 	vpcResources := NewVPCResources(stack, fmt.Sprintf("%s-VPC", id), &VPCResourcesProps{
-		IngressRule: props.MinecraftServerConfig.IngressPort,
+		IngressRules: ingressRules,
+		EnableIPv6:   props.VpcEnableIPv6,
 	})
 
-	// Create SNS resources using the provided SnsEmail
+	// Create SNS resources with the configured subscriptions
 	snsresources := NewSNSResources(stack, fmt.Sprintf("%s-SNS", id), &SNSResourcesProps{
-		SnsEmail: props.SnsEmail,
+		Subscriptions: props.SnsSubscriptions,
+		AlarmNames:    props.QueryLogAlarmNames,
 	})
 
-	route53Resources := NewRoute53Resources(stack, fmt.Sprintf("%s-Route53", id), &Route53ResourcesProps{
-		UsEast1LogGroupArn: props.UsEastLogGroupArn,
-		ServerSubDomain:    props.Route53ServerSubDomain,
-		Domain:             props.Route53Domain,
-		HostedZoneId:       props.Route53HostedZoneId,
-	})
+	// Create the learned resolver table shared by the launcher and watchdog
+	var resolverTable awsdynamodb.Table
+	if props.LambdaLearnResolvers {
+		resolverTable = NewResolverTable(stack, id)
+	}
 
-	// Add ECS Resources
-	ecsResources := NewECSResources(stack, fmt.Sprintf("%s-ECS", id), &ECSResourcesProps{
-		CpuSize:               props.EcsCpuSize,
-		Domain:                props.Route53Domain,
-		EnablePersistence:     props.EcsEnablePersistence,
-		HostedZoneId:          props.Route53HostedZoneId,
-		MemorySize:            props.EcsMemorySize,
-		ServerDebug:           props.MinecraftServerConfig.Debug,
-		ServerImage:           props.MinecraftServerConfig.Image,
-		ServerPort:            props.MinecraftServerConfig.Port,
-		ServerProtocol:        props.MinecraftServerConfig.Protocol,
-		ServerSubDomain:       props.Route53ServerSubDomain,
-		ShutdownMin:           props.EcsShutdownMin,
-		SnsTopic:              snsresources.SnsTopic,
-		StartupMin:            props.EcsStartupMin,
-		SubDomainHostedZoneId: route53Resources.SubDomainZoneId,
-		Vpc:                   vpcResources.Vpc,
-		SecurityGroup:         vpcResources.SecurityGroup,
-
-		// Minecraft Server Settings
-		MinecraftServerConfig: props.MinecraftServerConfig,
-	})
+	// Webhook URLs of the notification sinks, by watchdog environment variable
+	notifierSecrets := map[string]string{
+		"DISCORD_WEBHOOK_URL": props.NotifyDiscordSecret,
+		"SLACK_WEBHOOK_URL":   props.NotifySlackSecret,
+		"WEBHOOK_URL":         props.NotifyWebhookSecret,
+	}
+
+	// Create the ECS cluster shared by all servers
+	cluster := NewECSCluster(stack, fmt.Sprintf("%s-ECS", id), vpcResources.Vpc)
+
+	var queryLogGroup awslogs.LogGroup
+	var launcherServers []LauncherServer
+	for i, server := range props.Servers {
+		// The first server keeps the construct IDs of a single server, so
+		// servers can be added to an existing deployment
+		serverID := id
+		if i > 0 {
+			serverID = fmt.Sprintf("%s-%s", id, server.Name)
+		}
+
+		route53Resources := NewRoute53Resources(stack, fmt.Sprintf("%s-Route53", serverID), &Route53ResourcesProps{
+			UsEast1LogGroupArn: props.UsEastLogGroupArn,
+			WakeMode:           props.LambdaWakeMode,
+			ServerSubDomain:    server.Route53ServerSubDomain,
+			Domain:             props.Route53Domain,
+			HostedZoneId:       props.Route53HostedZoneId,
+			ParkingIP:          server.Route53ParkingIP,
+			SrvPort:            server.MinecraftServerConfig.SrvPort,
+			Primary:            i == 0,
+		})
+		if i == 0 {
+			queryLogGroup = route53Resources.QueryLogGroup
+		}
+
+		// Add ECS Resources
+		ecsResources := NewECSResources(stack, fmt.Sprintf("%s-ECS", serverID), &ECSResourcesProps{
+			CapacityMode:          server.EcsCapacityMode,
+			Cluster:               cluster,
+			CpuSize:               server.EcsCpuSize,
+			DNSParkingIP:          route53Resources.ParkingIP,
+			Domain:                props.Route53Domain,
+			EnablePersistence:     server.EcsEnablePersistence,
+			EnableIPv6:            props.VpcEnableIPv6,
+			HostedZoneId:          props.Route53HostedZoneId,
+			MemorySize:            server.EcsMemorySize,
+			ServerDebug:           server.MinecraftServerConfig.Debug,
+			ServerImage:           server.MinecraftServerConfig.Image,
+			ServerPort:            server.MinecraftServerConfig.Port,
+			ServerProtocol:        server.MinecraftServerConfig.Protocol,
+			ServerSubDomain:       server.Route53ServerSubDomain,
+			ShutdownMin:           server.EcsShutdownMin,
+			SessionStore:          server.EcsSessionStore,
+			ResolverTable:         resolverTable,
+			ShutdownWarnings:      server.EcsShutdownWarnings,
+			SnsTopic:              snsresources.SnsTopic,
+			NotifierSecrets:       notifierSecrets,
+			StartupMin:            server.EcsStartupMin,
+			SubDomainHostedZoneId: route53Resources.SubDomainZoneId,
+			Vpc:                   vpcResources.Vpc,
+			SecurityGroup:         vpcResources.SecurityGroup,
+
+			// Minecraft Server Settings
+			MinecraftServerConfig: server.MinecraftServerConfig,
+		})
+
+		launcherServers = append(launcherServers, LauncherServer{
+			Name:         server.Address(props.Route53Domain),
+			Service:      ecsResources.Service,
+			Edition:      server.MinecraftServerConfig.Edition,
+			CapacityMode: server.EcsCapacityMode,
+		})
+	}
 
 	// Add Lambda Resources
 	NewLambdaResources(stack, fmt.Sprintf("%s-Lambda", id), &LambdaResourcesProps{
-		QueryLogGroup:   route53Resources.QueryLogGroup,
-		Cluster:         ecsResources.Cluster,
-		Service:         ecsResources.Service,
-		ServerSubDomain: props.Route53ServerSubDomain,
-		Domain:          props.Route53Domain,
+		QueryLogGroup:   queryLogGroup,
+		Cluster:         cluster,
+		Servers:         launcherServers,
+		SnsTopic:        snsresources.SnsTopic,
+		WakeRecordTypes: props.LambdaWakeRecordTypes,
+		ResolverFilter:  props.LambdaResolverFilter,
+		ResolverTable:   resolverTable,
+		WakeMode:        props.LambdaWakeMode,
 	})
 
 	return stack
 }
 
 // ConfigureServer sets up the server configuration based on edition.
-func ConfigureServer(edition, debug string) ServerConfig {
-	port := 25565
+func ConfigureServer(env serverEnv, edition, debug string) ServerConfig {
+	port := env.getPortOrDefault("MINECRAFT_SERVER_PORT", 25565)
 	protocol := awsecs.Protocol_TCP
 	image := "itzg/minecraft-server"
 	ingressPort := awsec2.Port_Tcp(jsii.Number(float64(port)))
 
 	if edition != "java" {
-		port = 19132
+		edition = "bedrock"
+		port = env.getPortOrDefault("MINECRAFT_SERVER_PORT", 19132)
 		protocol = awsecs.Protocol_UDP
 		image = "itzg/minecraft-bedrock-server"
 		ingressPort = awsec2.Port_Udp(jsii.Number(float64(port)))
 	}
 
+	// SRV records are only looked up by Java clients
+	srvPort := 0
+	if edition == "java" && env.getOrDefault("ROUTE53_ENABLE_SRV", "false") == "true" {
+		srvPort = env.getPortOrDefault("ROUTE53_SRV_PORT", port)
+	}
+
 	return ServerConfig{
+		Edition:                    edition,
 		Port:                       port,
+		RconPort:                   env.getPortOrDefault("MINECRAFT_RCON_PORT", 25575),
+		QueryPort:                  env.getPortOrDefault("MINECRAFT_QUERY_PORT", port),
+		SrvPort:                    srvPort,
 		Protocol:                   protocol,
 		Image:                      image,
 		Debug:                      debug == "true",
 		IngressPort:                ingressPort,
-		Version:                    getEnvOrDefault("MINECRAFT_VERSION", "LATEST"),
-		Motd:                       getEnvOrDefault("MINECRAFT_MOTD", "Welcome to the on-demand minecraft server!"),
-		Difficulty:                 getEnvOrDefault("MINECRAFT_DIFFICULTY", "easy"),
-		MaxPlayers:                 getEnvOrDefault("MINECRAFT_MAX_PLAYERS", "20"),
-		AllowNether:                getEnvOrDefault("MINECRAFT_ALLOW_NETHER", "true"),
-		AnnouncePlayerAchievements: getEnvOrDefault("MINECRAFT_ANNOUNCE_PLAYER_ACHIEVEMENTS", "true"),
-		GenerateStructures:         getEnvOrDefault("MINECRAFT_GENERATE_STRUCTURES", "true"),
-		Hardcore:                   getEnvOrDefault("MINECRAFT_HARDCORE", "false"),
-		SnooperEnabled:             getEnvOrDefault("MINECRAFT_SNOOPER_ENABLED", "true"),
-		MaxBuildHeight:             getEnvOrDefault("MINECRAFT_MAX_BUILD_HEIGHT", "256"),
-		SpawnAnimals:               getEnvOrDefault("MINECRAFT_SPAWN_ANIMALS", "true"),
-		SpawnMonsters:              getEnvOrDefault("MINECRAFT_SPAWN_MONSTERS", "true"),
-		SpawnNpcs:                  getEnvOrDefault("MINECRAFT_SPAWN_NPCS", "true"),
-		Seed:                       getEnvOrDefault("MINECRAFT_SEED", ""),
-		Mode:                       getEnvOrDefault("MINECRAFT_MODE", "survival"),
-		Pvp:                        getEnvOrDefault("MINECRAFT_PVP", "true"),
-		OnlineMode:                 getEnvOrDefault("MINECRAFT_ONLINE_MODE", "true"),
-		ServerName:                 getEnvOrDefault("MINECRAFT_SERVER_NAME", ""),
-		EnableWhitelist:            getEnvOrDefault("MINECRAFT_ENABLE_WHITELIST", "false"),
-		Whitelist:                  getEnvOrDefault("MINECRAFT_WHITELIST", ""),
-		OpPermissionLevel:          getEnvOrDefault("MINECRAFT_OP_PERMISSION_LEVEL", "1"),
-		LevelType:                  getEnvOrDefault("MINECRAFT_LEVEL_TYPE", "minecraft:default"),
-		SpawnProtection:            getEnvOrDefault("MINECRAFT_SPAWN_PROTECTION", "0"),
-		ViewDistance:               getEnvOrDefault("MINECRAFT_VIEW_DISTANCE", "10"),
-		Icon:                       getEnvOrDefault("MINECRAFT_ICON", ""),
-		OverrideIcon:               getEnvOrDefault("MINECRAFT_OVERRIDE_ICON", "false"),
-		OverrideWhitelist:          getEnvOrDefault("MINECRAFT_OVERRIDE_WHITELIST", "false"),
+		Version:                    env.getOrDefault("MINECRAFT_VERSION", "LATEST"),
+		Motd:                       env.getOrDefault("MINECRAFT_MOTD", "Welcome to the on-demand minecraft server!"),
+		Difficulty:                 env.getOrDefault("MINECRAFT_DIFFICULTY", "easy"),
+		MaxPlayers:                 env.getOrDefault("MINECRAFT_MAX_PLAYERS", "20"),
+		AllowNether:                env.getOrDefault("MINECRAFT_ALLOW_NETHER", "true"),
+		AnnouncePlayerAchievements: env.getOrDefault("MINECRAFT_ANNOUNCE_PLAYER_ACHIEVEMENTS", "true"),
+		GenerateStructures:         env.getOrDefault("MINECRAFT_GENERATE_STRUCTURES", "true"),
+		Hardcore:                   env.getOrDefault("MINECRAFT_HARDCORE", "false"),
+		SnooperEnabled:             env.getOrDefault("MINECRAFT_SNOOPER_ENABLED", "true"),
+		MaxBuildHeight:             env.getOrDefault("MINECRAFT_MAX_BUILD_HEIGHT", "256"),
+		SpawnAnimals:               env.getOrDefault("MINECRAFT_SPAWN_ANIMALS", "true"),
+		SpawnMonsters:              env.getOrDefault("MINECRAFT_SPAWN_MONSTERS", "true"),
+		SpawnNpcs:                  env.getOrDefault("MINECRAFT_SPAWN_NPCS", "true"),
+		Seed:                       env.getOrDefault("MINECRAFT_SEED", ""),
+		Mode:                       env.getOrDefault("MINECRAFT_MODE", "survival"),
+		Pvp:                        env.getOrDefault("MINECRAFT_PVP", "true"),
+		OnlineMode:                 env.getOrDefault("MINECRAFT_ONLINE_MODE", "true"),
+		ServerName:                 env.getOrDefault("MINECRAFT_SERVER_NAME", ""),
+		EnableWhitelist:            env.getOrDefault("MINECRAFT_ENABLE_WHITELIST", "false"),
+		Whitelist:                  env.getOrDefault("MINECRAFT_WHITELIST", ""),
+		OpPermissionLevel:          env.getOrDefault("MINECRAFT_OP_PERMISSION_LEVEL", "1"),
+		LevelType:                  env.getOrDefault("MINECRAFT_LEVEL_TYPE", "minecraft:default"),
+		SpawnProtection:            env.getOrDefault("MINECRAFT_SPAWN_PROTECTION", "0"),
+		ViewDistance:               env.getOrDefault("MINECRAFT_VIEW_DISTANCE", "10"),
+		Icon:                       env.getOrDefault("MINECRAFT_ICON", ""),
+		OverrideIcon:               env.getOrDefault("MINECRAFT_OVERRIDE_ICON", "false"),
+		OverrideWhitelist:          env.getOrDefault("MINECRAFT_OVERRIDE_WHITELIST", "false"),
 	}
 }
 
@@ -185,6 +299,135 @@ func getEnvOrDefault(envVar, defaultValue string) string {
 	return defaultValue
 }
 
+// serverEnv reads the environment variables of a server. Variables prefixed
+// with the upper-case server name, e.g. CREATIVE_ECS_MEMORY_SIZE, take
+// precedence over the unprefixed ones shared by all servers.
+type serverEnv string
+
+// newServerEnv returns the environment of the server named name, which is
+// empty for the server of a single server deployment.
+func newServerEnv(name string) serverEnv {
+	if name == "" {
+		return ""
+	}
+	return serverEnv(strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_")
+}
+
+// lookup returns the value of envVar and the name of the variable it was read from.
+func (e serverEnv) lookup(envVar string) (string, string) {
+	if e != "" {
+		if value := os.Getenv(string(e) + envVar); value != "" {
+			return value, string(e) + envVar
+		}
+	}
+	return os.Getenv(envVar), envVar
+}
+
+// Helper function to get a server's environment variable or default value.
+func (e serverEnv) getOrDefault(envVar, defaultValue string) string {
+	if value, _ := e.lookup(envVar); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// Helper function to get a port from an environment variable or a default value.
+func (e serverEnv) getPortOrDefault(envVar string, defaultValue int) int {
+	value, name := e.lookup(envVar)
+	if value == "" {
+		return defaultValue
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		log.Fatalf("%s must be a port number, got %q", name, value)
+	}
+	return port
+}
+
+// Helper function to get the capacity mode from an environment variable, defaulting to on-demand Fargate.
+func (e serverEnv) getCapacityMode(envVar string) capacity.Mode {
+	value, name := e.lookup(envVar)
+	mode, err := capacity.ParseMode(cmp.Or(value, string(capacity.Fargate)))
+	if err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+	return mode
+}
+
+// Helper function to get a required environment variable of a server.
+func (e serverEnv) getRequired(envVar string) string {
+	value, name := e.lookup(envVar)
+	if value == "" {
+		log.Fatalf("%s environment variable is required", name)
+	}
+	return value
+}
+
+// Helper function to get the wake mode from an environment variable, defaulting to forwarding query logs.
+func getWakeMode(envVar string) wake.Mode {
+	mode, err := wake.ParseMode(getEnvOrDefault(envVar, string(wake.Logs)))
+	if err != nil {
+		log.Fatalf("%s: %v", envVar, err)
+	}
+	return mode
+}
+
+// Helper function to get the SNS subscriptions. SNS_EMAIL and SNS_HTTPS_ENDPOINT
+// each add a subscription, optionally filtered to the events listed in
+// SNS_EMAIL_EVENTS and SNS_HTTPS_EVENTS.
+func getSNSSubscriptions() []SNSSubscription {
+	var subscriptions []SNSSubscription
+	for _, sub := range []struct {
+		protocol               awssns.SubscriptionProtocol
+		endpointEnv, eventsEnv string
+	}{
+		{awssns.SubscriptionProtocol_EMAIL, "SNS_EMAIL", "SNS_EMAIL_EVENTS"},
+		{awssns.SubscriptionProtocol_HTTPS, "SNS_HTTPS_ENDPOINT", "SNS_HTTPS_EVENTS"},
+	} {
+		endpoint := os.Getenv(sub.endpointEnv)
+		if endpoint == "" {
+			continue
+		}
+		subscriptions = append(subscriptions, SNSSubscription{
+			Protocol:   sub.protocol,
+			Endpoint:   endpoint,
+			EventTypes: getEventTypes(sub.eventsEnv),
+		})
+	}
+	return subscriptions
+}
+
+// Helper function to parse a comma separated list of notification events.
+func getEventTypes(envVar string) []notify.Event {
+	var events []notify.Event
+	for _, name := range strings.Split(os.Getenv(envVar), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		event, err := notify.ParseEvent(name)
+		if err != nil {
+			log.Fatalf("%s: %v", envVar, err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// Helper function to get the resolver rules of the launcher. They are parsed
+// here as well, so invalid rules fail the synth rather than the launcher.
+func getResolverFilter() ResolverFilterConfig {
+	cfg := ResolverFilterConfig{
+		AllowCIDRs:    os.Getenv("LAUNCHER_ALLOW_RESOLVER_CIDRS"),
+		DenyCIDRs:     os.Getenv("LAUNCHER_DENY_RESOLVER_CIDRS"),
+		EdgeLocations: os.Getenv("LAUNCHER_ALLOW_EDGE_LOCATIONS"),
+	}
+	split := func(s string) []string { return strings.Split(s, ",") }
+	if _, err := resolvers.NewFilter(split(cfg.AllowCIDRs), split(cfg.DenyCIDRs), split(cfg.EdgeLocations)); err != nil {
+		log.Fatalf("Invalid launcher resolver rules: %v", err)
+	}
+	return cfg
+}
+
 // ParseEnv retrieves environment variables and configures stack properties.
 func ParseEnv() MinecraftServerStackProps {
 	return MinecraftServerStackProps{
@@ -194,21 +437,84 @@ func ParseEnv() MinecraftServerStackProps {
 				Region:  jsii.String(getRequiredEnv("AWS_DESTINATION_REGION")),
 			},
 		},
-		EcsMinecraftEdition:    getEnvOrDefault("ECS_MINECRAFT_EDITION", "java"),
-		Route53ServerSubDomain: getRequiredEnv("ROUTE53_SERVER_SUBDOMAIN"),
-		Route53Domain:          getRequiredEnv("ROUTE53_DOMAIN"),
-		Route53HostedZoneId:    getRequiredEnv("ROUTE53_HOSTED_ZONE_ID"),
-		EcsMemorySize:          getEnvOrDefault("ECS_MEMORY_SIZE", "8192"),
-		EcsCpuSize:             getEnvOrDefault("ECS_CPU_SIZE", "4096"),
-		SnsEmail:               getRequiredEnv("SNS_EMAIL"),
-		EcsStartupMin:          getEnvOrDefault("ECS_STARTUP_MIN", "10"),
-		EcsShutdownMin:         getEnvOrDefault("ECS_SHUTDOWN_MIN", "20"),
-		EcsDebug:               getEnvOrDefault("ECS_DEBUG", "false"),
-		EcsEnablePersistence:   getEnvOrDefault("ECS_ENABLE_PERSISTENCE", "false") == "true",
-		MinecraftServerConfig:  ConfigureServer(getEnvOrDefault("ECS_MINECRAFT_EDITION", "java"), getEnvOrDefault("ECS_DEBUG", "false")),
+		Route53Domain:         getRequiredEnv("ROUTE53_DOMAIN"),
+		Route53HostedZoneId:   getRequiredEnv("ROUTE53_HOSTED_ZONE_ID"),
+		SnsSubscriptions:      getSNSSubscriptions(),
+		LambdaWakeRecordTypes: getEnvOrDefault("LAUNCHER_WAKE_RECORD_TYPES", "A,AAAA,SRV"),
+		LambdaResolverFilter:  getResolverFilter(),
+		LambdaLearnResolvers:  getEnvOrDefault("LAUNCHER_LEARN_RESOLVERS", "false") == "true",
+		LambdaWakeMode:        getWakeMode("LAUNCHER_WAKE_MODE"),
+		NotifyDiscordSecret:   os.Getenv("NOTIFY_DISCORD_WEBHOOK_SECRET"),
+		NotifySlackSecret:     os.Getenv("NOTIFY_SLACK_WEBHOOK_SECRET"),
+		NotifyWebhookSecret:   os.Getenv("NOTIFY_WEBHOOK_SECRET"),
+		VpcEnableIPv6:         getEnvOrDefault("VPC_ENABLE_IPV6", "false") == "true",
+		Servers:               getServers(),
+	}
+}
+
+// Helper function to get the servers listed in MINECRAFT_SERVERS, e.g.
+// "survival,creative", or a single server if it is unset.
+func getServers() []ServerProps {
+	var servers []ServerProps
+	names := make(map[string]bool)
+	subDomains := make(map[string]string)
+	for _, name := range strings.Split(os.Getenv("MINECRAFT_SERVERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !serverNamePattern.MatchString(name) {
+			log.Fatalf("MINECRAFT_SERVERS: invalid server name %q, want lower-case letters, digits and dashes", name)
+		}
+		if names[name] {
+			log.Fatalf("MINECRAFT_SERVERS: duplicate server name %q", name)
+		}
+		names[name] = true
+
+		server := getServer(name)
+		subDomain := strings.ToLower(server.Route53ServerSubDomain)
+		if other, ok := subDomains[subDomain]; ok {
+			log.Fatalf("Servers %q and %q share the subdomain %q, set %sROUTE53_SERVER_SUBDOMAIN", other, name, subDomain, newServerEnv(name))
+		}
+		subDomains[subDomain] = name
+		servers = append(servers, server)
+	}
+	if len(servers) == 0 {
+		servers = append(servers, getServer(""))
+	}
+	return servers
+}
+
+// serverNamePattern matches the names of MINECRAFT_SERVERS. They are part of
+// construct IDs and resource names.
+var serverNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// Helper function to get the settings of the server named name.
+func getServer(name string) ServerProps {
+	env := newServerEnv(name)
+	return ServerProps{
+		Name:                   name,
+		EcsMinecraftEdition:    env.getOrDefault("ECS_MINECRAFT_EDITION", "java"),
+		Route53ServerSubDomain: env.getRequired("ROUTE53_SERVER_SUBDOMAIN"),
+		Route53ParkingIP:       env.getOrDefault("ROUTE53_PARKING_IP", "192.168.1.1"),
+		EcsMemorySize:          env.getOrDefault("ECS_MEMORY_SIZE", "8192"),
+		EcsCpuSize:             env.getOrDefault("ECS_CPU_SIZE", "4096"),
+		EcsCapacityMode:        env.getCapacityMode("ECS_CAPACITY_MODE"),
+		EcsStartupMin:          env.getOrDefault("ECS_STARTUP_MIN", "10"),
+		EcsShutdownMin:         env.getOrDefault("ECS_SHUTDOWN_MIN", "20"),
+		EcsShutdownWarnings:    env.getOrDefault("ECS_SHUTDOWN_WARNINGS", "5m,1m,10s"),
+		EcsSessionStore:        env.getOrDefault("ECS_SESSION_STORE", "jsonl"),
+		EcsDebug:               env.getOrDefault("ECS_DEBUG", "false"),
+		EcsEnablePersistence:   env.getOrDefault("ECS_ENABLE_PERSISTENCE", "false") == "true",
+		MinecraftServerConfig:  ConfigureServer(env, env.getOrDefault("ECS_MINECRAFT_EDITION", "java"), env.getOrDefault("ECS_DEBUG", "false")),
 	}
 }
 
+// Address returns the address of the server, by which queries are routed to it.
+func (s ServerProps) Address(domain string) string {
+	return strings.ToLower(serverName(s.Route53ServerSubDomain, domain))
+}
+
 // Helper to fetch required environment variables.
 func getRequiredEnv(envVar string) string {
 	value := os.Getenv(envVar)
@@ -225,18 +531,28 @@ func main() {
 
 	stackName := getEnvOrDefault("AWS_STACK_NAME", "MinecraftServerStack")
 
-	// Create Query Log Stack in `us-east-1`
+	minecraftServerStackProps := ParseEnv()
+
+	var serverNames []string
+	for _, server := range minecraftServerStackProps.Servers {
+		serverNames = append(serverNames, server.Address(minecraftServerStackProps.Route53Domain))
+	}
+
+	// Create Query Log Stack in `us-east-1`, shared by all servers. Stacks in
+	// different regions cannot reference each other, so the launcher is
+	// addressed by name.
 	queryLogStack := NewQueryLogStack(app, fmt.Sprintf("%s-QueryLogGroupStack", stackName), &QueryLogStackProps{
 		StackProps:           awscdk.StackProps{Env: &awscdk.Environment{Region: jsii.String("us-east-1")}},
-		ServerSubDomain:      os.Getenv("ROUTE53_SERVER_SUBDOMAIN"),
-		Domain:               os.Getenv("ROUTE53_DOMAIN"),
-		DestinationAccountId: os.Getenv("AWS_DESTINATION_ACCOUNT"),
-		DestinationRegion:    os.Getenv("AWS_DESTINATION_REGION"),
+		ServerNames:          serverNames,
+		DestinationAccountId: getRequiredEnv("AWS_DESTINATION_ACCOUNT"),
+		DestinationRegion:    getRequiredEnv("AWS_DESTINATION_REGION"),
+		WakeMode:             minecraftServerStackProps.LambdaWakeMode,
+		LauncherFunctionName: launcherFunctionName(fmt.Sprintf("%s-Lambda", stackName)),
 	})
 
-	// Create Minecraft Server Stack and set dependency
-	minecraftServerStackProps := ParseEnv()
+	// Set the dependency of the Minecraft Server Stack
 	minecraftServerStackProps.UsEastLogGroupArn = *queryLogStack.QueryLogGroup.LogGroupArn()
+	minecraftServerStackProps.QueryLogAlarmNames = queryLogStack.AlarmNames
 
 	// Create the server stack
 	NewMinecraftServerStack(app, stackName, &minecraftServerStackProps)
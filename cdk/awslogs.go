@@ -2,34 +2,47 @@ package main
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/aws/aws-cdk-go/awscdk/v2"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awscloudwatch"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsevents"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awseventstargets"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsiam"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awslambda"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awslambdadestinations"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awslogs"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awslogsdestinations"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awssqs"
 	"github.com/aws/constructs-go/constructs/v10"
 	"github.com/aws/jsii-runtime-go"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/wake"
 )
 
 type QueryLogStackProps struct {
 	awscdk.StackProps
-	ServerSubDomain      string
-	Domain               string
+	// ServerNames are the addresses of all servers, whose hosted zones share
+	// the log group. It is named after the first one.
+	ServerNames          []string
 	DestinationAccountId string // Account ID to construct the destination ARN
 	DestinationRegion    string // Destination region (e.g., "eu-central-1")
+	WakeMode             wake.Mode
+	LauncherFunctionName string // Launcher invoked in the invoke wake mode
 }
 
 type QueryLogStack struct {
 	awscdk.Stack
 	QueryLogGroup awslogs.LogGroup
+	// AlarmNames are the alarms on lost wake signals. Their state changes are
+	// sent to the default event bus of the destination region.
+	AlarmNames []string
 }
 
 func NewQueryLogStack(scope constructs.Construct, id string, props *QueryLogStackProps) *QueryLogStack {
 	stack := awscdk.NewStack(scope, &id, &props.StackProps)
 
 	// Create the log group for Route53 query logs in `us-east-1`
-	logGroupName := fmt.Sprintf("/aws/route53/%s.%s", props.ServerSubDomain, props.Domain)
+	logGroupName := fmt.Sprintf("/aws/route53/%s", props.ServerNames[0])
 	queryLogGroupID := fmt.Sprintf("%s-QueryLogGroup", id)
 	queryLogGroup := awslogs.NewLogGroup(stack, jsii.String(queryLogGroupID), &awslogs.LogGroupProps{
 		LogGroupName:  jsii.String(logGroupName),
@@ -58,6 +71,45 @@ func NewQueryLogStack(scope constructs.Construct, id string, props *QueryLogStac
 			}),
 		},
 	})
+	// Grant the forwarder access to the target of the wake mode and tell it
+	// where to find it
+	serverNames := strings.Join(props.ServerNames, ", ")
+	environment := map[string]*string{
+		"WAKE_MODE":     jsii.String(string(props.WakeMode)),
+		"TARGET_REGION": jsii.String(props.DestinationRegion),
+		"SERVERNAMES":   jsii.String(strings.Join(props.ServerNames, ",")),
+	}
+	var forwardingStatement awsiam.PolicyStatement
+	switch props.WakeMode {
+	case wake.EventBridge:
+		eventBusArn := fmt.Sprintf("arn:aws:events:%s:%s:event-bus/default", props.DestinationRegion, props.DestinationAccountId)
+		environment["TARGET_EVENT_BUS_ARN"] = jsii.String(eventBusArn)
+		forwardingStatement = awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+			Actions:   jsii.Strings("events:PutEvents"),
+			Resources: jsii.Strings(eventBusArn),
+		})
+	case wake.Invoke:
+		functionArn := fmt.Sprintf("arn:aws:lambda:%s:%s:function:%s", props.DestinationRegion, props.DestinationAccountId, props.LauncherFunctionName)
+		environment["TARGET_FUNCTION_ARN"] = jsii.String(functionArn)
+		forwardingStatement = awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+			Actions:   jsii.Strings("lambda:InvokeFunction"),
+			Resources: jsii.Strings(functionArn),
+		})
+	default:
+		logGroupArn := fmt.Sprintf("arn:aws:logs:%s:%s:log-group:%s:*", props.DestinationRegion, props.DestinationAccountId, logGroupName)
+		environment["TARGET_LOG_GROUP_ARN"] = jsii.String(logGroupArn)
+		environment["TARGET_LOG_GROUP_NAME"] = queryLogGroup.LogGroupName()
+		forwardingStatement = awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+			Actions: &[]*string{
+				jsii.String("logs:PutLogEvents"),
+				jsii.String("logs:CreateLogStream"),
+			},
+			Resources: &[]*string{
+				jsii.String(logGroupArn),
+			},
+		})
+	}
+
 	// IAM Role for Lambda to forward logs
 	lambdaRoleID := fmt.Sprintf("%s-LogForwarderRole", id)
 	lambdaRole := awsiam.NewRole(stack, jsii.String(lambdaRoleID), &awsiam.RoleProps{
@@ -68,21 +120,18 @@ func NewQueryLogStack(scope constructs.Construct, id string, props *QueryLogStac
 		},
 		InlinePolicies: &map[string]awsiam.PolicyDocument{
 			"AllowLogForwarding": awsiam.NewPolicyDocument(&awsiam.PolicyDocumentProps{
-				Statements: &[]awsiam.PolicyStatement{
-					awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
-						Actions: &[]*string{
-							jsii.String("logs:PutLogEvents"),
-							jsii.String("logs:CreateLogStream"),
-						},
-						Resources: &[]*string{
-							jsii.String(fmt.Sprintf("arn:aws:logs:%s:%s:log-group:%s:*", props.DestinationRegion, props.DestinationAccountId, logGroupName)),
-						},
-					}),
-				},
+				Statements: &[]awsiam.PolicyStatement{forwardingStatement},
 			}),
 		},
 	})
 
+	// Keep invocations that failed after Lambda's retries
+	deadLetterQueueID := fmt.Sprintf("%s-LogForwarderDLQ", id)
+	deadLetterQueue := awssqs.NewQueue(stack, jsii.String(deadLetterQueueID), &awssqs.QueueProps{
+		QueueName:       jsii.String(deadLetterQueueID),
+		RetentionPeriod: awscdk.Duration_Days(jsii.Number(14)),
+	})
+
 	// Create Lambda function to forward logs
 	logForwarderLambdaID := fmt.Sprintf("%s-LogForwarderLambda", id)
 	logForwarderLambda := awslambda.NewFunction(stack, jsii.String(logForwarderLambdaID), &awslambda.FunctionProps{
@@ -93,24 +142,82 @@ func NewQueryLogStack(scope constructs.Construct, id string, props *QueryLogStac
 		Runtime:      awslambda.Runtime_PROVIDED_AL2023(),
 		Architecture: awslambda.Architecture_ARM_64(),
 		LogRetention: awslogs.RetentionDays_ONE_WEEK,
-		Environment: &map[string]*string{
-			"TARGET_LOG_GROUP_ARN":  jsii.String(fmt.Sprintf("arn:aws:logs:%s:%s:log-group:%s:*", props.DestinationRegion, props.DestinationAccountId, logGroupName)),
-			"TARGET_LOG_GROUP_NAME": queryLogGroup.LogGroupName(),
-		},
+		Environment:  &environment,
+		// Leave room for the forwarder's own retries
+		Timeout:       awscdk.Duration_Seconds(jsii.Number(30)),
+		RetryAttempts: jsii.Number(2),
+		MaxEventAge:   awscdk.Duration_Hours(jsii.Number(1)),
+		OnFailure:     awslambdadestinations.NewSqsDestination(deadLetterQueue),
 	})
 
 	// Add CloudWatch Logs subscription filter
+	var filterTerms []*string
+	for _, serverName := range props.ServerNames {
+		filterTerms = append(filterTerms, jsii.String(serverName), jsii.String(srvName(serverName)))
+	}
 	subscriptionFilterID := fmt.Sprintf("%s-SubscriptionFilter", id)
 	queryLogGroup.AddSubscriptionFilter(jsii.String(subscriptionFilterID), &awslogs.SubscriptionFilterOptions{
-		Destination: awslogsdestinations.NewLambdaDestination(logForwarderLambda, &awslogsdestinations.LambdaDestinationOptions{}),
-		FilterPattern: awslogs.FilterPattern_AllTerms(
-			// jsii.String("_minecraft._tcp"),
-			// jsii.String("SRV"),
-			jsii.String(fmt.Sprintf("%s.%s", props.ServerSubDomain, props.Domain)),
-		),
+		Destination:   awslogsdestinations.NewLambdaDestination(logForwarderLambda, &awslogsdestinations.LambdaDestinationOptions{}),
+		FilterPattern: awslogs.FilterPattern_AnyTerm(filterTerms...),
+	})
+	// Alarm on failed invocations, partially delivered ones and invocations
+	// that exhausted their retries
+	errorsAlarmName := fmt.Sprintf("%s-LogForwarderErrors", id)
+	errorsAlarm := awscloudwatch.NewMathExpression(&awscloudwatch.MathExpressionProps{
+		Expression: jsii.String("FILL(errors, 0) + FILL(undelivered, 0)"),
+		UsingMetrics: &map[string]awscloudwatch.IMetric{
+			"errors": logForwarderLambda.MetricErrors(&awscloudwatch.MetricOptions{
+				Statistic: jsii.String("Sum"),
+			}),
+			"undelivered": awscloudwatch.NewMetric(&awscloudwatch.MetricProps{
+				Namespace:     jsii.String("MinecraftServer/LogForwarder"),
+				MetricName:    jsii.String("UndeliveredEvents"),
+				DimensionsMap: &map[string]*string{"LogGroup": jsii.String(logGroupName)},
+				Statistic:     jsii.String("Sum"),
+			}),
+		},
+		Label:  jsii.String("Log forwarder errors"),
+		Period: awscdk.Duration_Minutes(jsii.Number(5)),
+	}).CreateAlarm(stack, jsii.String(errorsAlarmName), &awscloudwatch.CreateAlarmOptions{
+		AlarmName:          jsii.String(errorsAlarmName),
+		AlarmDescription:   jsii.String(fmt.Sprintf("The log forwarder failed to deliver query logs of %s, players may not be able to start the servers.", serverNames)),
+		Threshold:          jsii.Number(1),
+		EvaluationPeriods:  jsii.Number(1),
+		ComparisonOperator: awscloudwatch.ComparisonOperator_GREATER_THAN_OR_EQUAL_TO_THRESHOLD,
+		TreatMissingData:   awscloudwatch.TreatMissingData_NOT_BREACHING,
 	})
+	deadLetterAlarmName := fmt.Sprintf("%s-LogForwarderDLQDepth", id)
+	deadLetterAlarm := deadLetterQueue.MetricApproximateNumberOfMessagesVisible(&awscloudwatch.MetricOptions{
+		Statistic: jsii.String("Maximum"),
+		Period:    awscdk.Duration_Minutes(jsii.Number(5)),
+	}).CreateAlarm(stack, jsii.String(deadLetterAlarmName), &awscloudwatch.CreateAlarmOptions{
+		AlarmName:          jsii.String(deadLetterAlarmName),
+		AlarmDescription:   jsii.String(fmt.Sprintf("Query logs of %s could not be delivered after all retries and wait in %s.", serverNames, deadLetterQueueID)),
+		Threshold:          jsii.Number(1),
+		EvaluationPeriods:  jsii.Number(1),
+		ComparisonOperator: awscloudwatch.ComparisonOperator_GREATER_THAN_OR_EQUAL_TO_THRESHOLD,
+		TreatMissingData:   awscloudwatch.TreatMissingData_NOT_BREACHING,
+	})
+
+	// Alarms can only notify topics in their own region, so state changes
+	// are sent to the destination region, where NewSNSResources publishes
+	// them to the servers' topic
+	alarmForwardingRuleID := fmt.Sprintf("%s-AlarmForwardingRule", id)
+	awsevents.NewRule(stack, jsii.String(alarmForwardingRuleID), &awsevents.RuleProps{
+		EventPattern: &awsevents.EventPattern{
+			Source:     jsii.Strings("aws.cloudwatch"),
+			DetailType: jsii.Strings("CloudWatch Alarm State Change"),
+			Resources:  &[]*string{errorsAlarm.AlarmArn(), deadLetterAlarm.AlarmArn()},
+		},
+		Targets: &[]awsevents.IRuleTarget{
+			awseventstargets.NewEventBus(awsevents.EventBus_FromEventBusArn(stack, jsii.String(fmt.Sprintf("%s-DestinationEventBus", id)),
+				jsii.String(fmt.Sprintf("arn:aws:events:%s:%s:event-bus/default", props.DestinationRegion, props.DestinationAccountId))), nil),
+		},
+	})
+
 	return &QueryLogStack{
 		Stack:         stack,
 		QueryLogGroup: queryLogGroup,
+		AlarmNames:    []string{errorsAlarmName, deadLetterAlarmName},
 	}
 }
@@ -3,55 +3,83 @@ package main
 import (
 	"fmt"
 	"log"
+	"maps"
 	"path"
+	"slices"
 	"strconv"
 
 	"github.com/aws/aws-cdk-go/awscdk/v2"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsdynamodb"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsec2"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsecs"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsefs"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsiam"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awslogs"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awssecretsmanager"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awssns"
+	"github.com/aws/aws-cdk-go/awscdk/v2/customresources"
 	"github.com/aws/constructs-go/constructs/v10"
 	"github.com/aws/jsii-runtime-go"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/capacity"
+)
+
+const (
+	// containerStopTimeout is the maximum Fargate allows between SIGTERM and SIGKILL.
+	containerStopTimeout = 120
+	// emergencyDrainTimeout leaves the watchdog headroom to exit before SIGKILL.
+	emergencyDrainTimeout = 100
 )
 
 type ECSResourcesProps struct {
-	Vpc                   awsec2.Vpc
-	SecurityGroup         awsec2.SecurityGroup
-	ServerSubDomain       string
-	Domain                string
-	HostedZoneId          string
-	MemorySize            string
-	CpuSize               string
-	SnsTopic              awssns.Topic
+	// Cluster is shared by all servers, see NewECSCluster.
+	Cluster         awsecs.Cluster
+	Vpc             awsec2.Vpc
+	SecurityGroup   awsec2.SecurityGroup
+	ServerSubDomain string
+	Domain          string
+	DNSParkingIP    string
+	HostedZoneId    string
+	MemorySize      string
+	CpuSize         string
+	SnsTopic        awssns.Topic
+	// NotifierSecrets maps watchdog environment variables to the names of
+	// Secrets Manager secrets holding webhook URLs. Empty names are skipped.
+	NotifierSecrets       map[string]string
 	StartupMin            string
 	ShutdownMin           string
+	ShutdownWarnings      string
 	ServerImage           string
 	ServerPort            int
 	ServerProtocol        awsecs.Protocol
 	ServerDebug           bool
 	SubDomainHostedZoneId string
 	EnablePersistence     bool
+	EnableIPv6            bool
+	CapacityMode          capacity.Mode
+	SessionStore          string
+	// ResolverTable stores learned resolvers, nil if learning is disabled.
+	ResolverTable         awsdynamodb.Table
 	MinecraftServerConfig ServerConfig
 }
 
 type ECSResources struct {
 	Task    awsecs.FargateTaskDefinition
-	Cluster awsecs.Cluster
 	Service awsecs.FargateService
 }
 
-func NewECSResources(scope constructs.Construct, id string, props *ECSResourcesProps) ECSResources {
-	// Create ECS Cluster
+// NewECSCluster creates the cluster the services of all servers run in.
+func NewECSCluster(scope constructs.Construct, id string, vpc awsec2.Vpc) awsecs.Cluster {
 	clusterID := fmt.Sprintf("%s-Cluster", id)
-	cluster := awsecs.NewCluster(scope, jsii.String(clusterID), &awsecs.ClusterProps{
-		Vpc:                            props.Vpc,
+	return awsecs.NewCluster(scope, jsii.String(clusterID), &awsecs.ClusterProps{
+		Vpc:                            vpc,
 		ClusterName:                    jsii.String(clusterID),
 		ContainerInsights:              jsii.Bool(true),
 		EnableFargateCapacityProviders: jsii.Bool(true),
 	})
+}
+
+func NewECSResources(scope constructs.Construct, id string, props *ECSResourcesProps) ECSResources {
+	cluster := props.Cluster
 
 	// Declare variables for EFS resources
 	var fileSystem awsefs.FileSystem
@@ -124,7 +152,7 @@ func NewECSResources(scope constructs.Construct, id string, props *ECSResourcesP
 		Cluster:     cluster,
 		CapacityProviderStrategies: &[]*awsecs.CapacityProviderStrategy{
 			{
-				CapacityProvider: jsii.String("FARGATE"),
+				CapacityProvider: jsii.String(props.CapacityMode.Provider()),
 				Weight:           jsii.Number(1),
 				Base:             jsii.Number(1),
 			},
@@ -137,6 +165,39 @@ func NewECSResources(scope constructs.Construct, id string, props *ECSResourcesP
 		EnableExecuteCommand: jsii.Bool(true),
 	})
 
+	// Fargate tasks only get an IPv6 address once the dualStackIPv6 account
+	// setting is enabled, which CloudFormation cannot manage natively.
+	if props.EnableIPv6 {
+		dualStackID := fmt.Sprintf("%s-DualStackSetting", id)
+		dualStackCall := &customresources.AwsSdkCall{
+			Service: jsii.String("ECS"),
+			Action:  jsii.String("putAccountSettingDefault"),
+			Parameters: map[string]*string{
+				"name":  jsii.String("dualStackIPv6"),
+				"value": jsii.String("enabled"),
+			},
+			PhysicalResourceId: customresources.PhysicalResourceId_Of(jsii.String(dualStackID)),
+		}
+		dualStackSetting := customresources.NewAwsCustomResource(scope, jsii.String(dualStackID), &customresources.AwsCustomResourceProps{
+			OnCreate: dualStackCall,
+			OnUpdate: dualStackCall,
+			Policy: customresources.AwsCustomResourcePolicy_FromSdkCalls(&customresources.SdkCallsPolicyOptions{
+				Resources: customresources.AwsCustomResourcePolicy_ANY_RESOURCE(),
+			}),
+		})
+		service.Node().AddDependency(dualStackSetting)
+	}
+
+	// RCON password shared by the server and the watchdog
+	rconSecretID := fmt.Sprintf("%s-RconSecret", id)
+	rconSecret := awssecretsmanager.NewSecret(scope, jsii.String(rconSecretID), &awssecretsmanager.SecretProps{
+		Description: jsii.String("RCON password for the Minecraft server"),
+		GenerateSecretString: &awssecretsmanager.SecretStringGenerator{
+			PasswordLength:     jsii.Number(32),
+			ExcludePunctuation: jsii.Bool(true),
+		},
+	})
+
 	var loggingDriver awsecs.LogDriver
 	if props.ServerDebug {
 		logPrefix := fmt.Sprintf("%s-Log", id)
@@ -149,11 +210,17 @@ func NewECSResources(scope constructs.Construct, id string, props *ECSResourcesP
 	}
 
 	// Main Server Container Definition
+	// The server is not essential: the watchdog stops it gracefully and must
+	// outlive it to scale the service down afterwards.
 	containerID := fmt.Sprintf("%s-ServerContainer", id)
 	serverContainer := task.AddContainer(jsii.String(containerID), &awsecs.ContainerDefinitionOptions{
-		Image: awsecs.ContainerImage_FromRegistry(jsii.String(props.ServerImage), nil),
+		Image:       awsecs.ContainerImage_FromRegistry(jsii.String(props.ServerImage), nil),
+		Essential:   jsii.Bool(false),
+		StopTimeout: awscdk.Duration_Seconds(jsii.Number(containerStopTimeout)),
 		Environment: &map[string]*string{
 			"EULA":                         jsii.String("TRUE"),
+			"SERVER_PORT":                  jsii.String(strconv.Itoa(props.ServerPort)),
+			"RCON_PORT":                    jsii.String(strconv.Itoa(props.MinecraftServerConfig.RconPort)),
 			"MEMORY":                       jsii.String("8G"),
 			"VERSION":                      jsii.String(props.MinecraftServerConfig.Version),
 			"MOTD":                         jsii.String(props.MinecraftServerConfig.Motd),
@@ -184,6 +251,9 @@ func NewECSResources(scope constructs.Construct, id string, props *ECSResourcesP
 			// todo(cbrgm): this option is disabled until the flag issue is handled in itzg/minecraft-server-docker
 			// "OVERRIDE_WHITELIST":           jsii.String(props.MinecraftServerConfig.OverrideWhitelist),
 		},
+		Secrets: &map[string]awsecs.Secret{
+			"RCON_PASSWORD": awsecs.Secret_FromSecretsManager(rconSecret, nil),
+		},
 		PortMappings: &[]*awsecs.PortMapping{
 			{
 				ContainerPort: jsii.Number(props.ServerPort),
@@ -219,26 +289,102 @@ func NewECSResources(scope constructs.Construct, id string, props *ECSResourcesP
 		fileSystem.Connections().AllowDefaultPortFrom(service, jsii.String("Allow ECS service to access EFS"))
 	}
 
+	// Player sessions are journaled next to the world on EFS by default, which
+	// needs persistence. Alternatively they are written to a DynamoDB table.
+	sessionStore := props.SessionStore
+	if sessionStore == "jsonl" && !props.EnablePersistence {
+		sessionStore = "none"
+	}
+	sessionTable := ""
+	if sessionStore == "dynamodb" {
+		tableID := fmt.Sprintf("%s-SessionTable", id)
+		table := awsdynamodb.NewTable(scope, jsii.String(tableID), &awsdynamodb.TableProps{
+			PartitionKey:  &awsdynamodb.Attribute{Name: jsii.String("player"), Type: awsdynamodb.AttributeType_STRING},
+			SortKey:       &awsdynamodb.Attribute{Name: jsii.String("joined_at"), Type: awsdynamodb.AttributeType_STRING},
+			BillingMode:   awsdynamodb.BillingMode_PAY_PER_REQUEST,
+			RemovalPolicy: awscdk.RemovalPolicy_RETAIN,
+		})
+		table.GrantWriteData(taskRole)
+		sessionTable = *table.TableName()
+	}
+
+	resolverTable := ""
+	if props.ResolverTable != nil {
+		props.ResolverTable.GrantReadWriteData(taskRole)
+		resolverTable = *props.ResolverTable.TableName()
+	}
+
+	// Webhook URLs carry their credentials, so they are injected from existing
+	// secrets rather than stored in the task definition.
+	watchdogSecrets := map[string]awsecs.Secret{
+		"RCON_PASSWORD": awsecs.Secret_FromSecretsManager(rconSecret, nil),
+	}
+	for _, envVar := range slices.Sorted(maps.Keys(props.NotifierSecrets)) {
+		secretName := props.NotifierSecrets[envVar]
+		if secretName == "" {
+			continue
+		}
+		secret := awssecretsmanager.Secret_FromSecretNameV2(scope, jsii.String(fmt.Sprintf("%s-%s", id, envVar)), jsii.String(secretName))
+		watchdogSecrets[envVar] = awsecs.Secret_FromSecretsManager(secret, nil)
+	}
+
 	// Add Watchdog Container
 	watchdogContainerID := fmt.Sprintf("%s-WatchdogContainer", id)
-	task.AddContainer(jsii.String(watchdogContainerID), &awsecs.ContainerDefinitionOptions{
+	watchdogContainer := task.AddContainer(jsii.String(watchdogContainerID), &awsecs.ContainerDefinitionOptions{
 		Image: awsecs.ContainerImage_FromAsset(jsii.String(path.Join(".", "cmd", "watchdog")), &awsecs.AssetImageProps{
 			File: jsii.String("Dockerfile"),
 		}),
-		Essential: jsii.Bool(true),
+		Essential:   jsii.Bool(true),
+		StopTimeout: awscdk.Duration_Seconds(jsii.Number(containerStopTimeout)),
 		Environment: &map[string]*string{
 			"CLUSTER":     cluster.ClusterName(),
 			"SERVICE":     jsii.String(serviceID),
 			"DNSZONE":     jsii.String(props.SubDomainHostedZoneId),
-			"SERVERNAME":  jsii.String(fmt.Sprintf("%s.%s", props.ServerSubDomain, props.Domain)),
+			"SERVERNAME":  jsii.String(serverName(props.ServerSubDomain, props.Domain)),
 			"SNSTOPIC":    props.SnsTopic.TopicArn(),
 			"STARTUPMIN":  jsii.String(props.StartupMin),
 			"SHUTDOWNMIN": jsii.String(props.ShutdownMin),
+
+			"SHUTDOWN_WARNINGS": jsii.String(props.ShutdownWarnings),
+			"STOP_TIMEOUT":      jsii.String(fmt.Sprintf("%ds", emergencyDrainTimeout)),
+			"DNS_PARKING_IP":    jsii.String(props.DNSParkingIP),
+			"SRV_PORT":          jsii.String(strconv.Itoa(props.MinecraftServerConfig.SrvPort)),
+			"CAPACITY_MODE":     jsii.String(string(props.CapacityMode)),
+			"EDITION":           jsii.String(props.MinecraftServerConfig.Edition),
+			"GAME_PORT":         jsii.String(strconv.Itoa(props.ServerPort)),
+			"RCON_PORT":         jsii.String(strconv.Itoa(props.MinecraftServerConfig.RconPort)),
+			"QUERY_PORT":        jsii.String(strconv.Itoa(props.MinecraftServerConfig.QueryPort)),
+			"SESSION_STORE":     jsii.String(sessionStore),
+			"SESSION_TABLE":     jsii.String(sessionTable),
+			"RESOLVER_TABLE":    jsii.String(resolverTable),
+		},
+		Secrets: &watchdogSecrets,
+		HealthCheck: &awsecs.HealthCheck{
+			Command:     jsii.Strings("CMD", "/usr/bin/watchdog", "--healthcheck"),
+			Interval:    awscdk.Duration_Seconds(jsii.Number(30)),
+			Timeout:     awscdk.Duration_Seconds(jsii.Number(5)),
+			Retries:     jsii.Number(3),
+			StartPeriod: awscdk.Duration_Seconds(jsii.Number(60)),
 		},
 		MemoryReservationMiB: jsii.Number(64),
 		Logging:              loggingDriver,
 	})
 
+	if props.EnablePersistence {
+		watchdogContainer.AddMountPoints(&awsecs.MountPoint{
+			ContainerPath: jsii.String("/data"),
+			SourceVolume:  jsii.String(fmt.Sprintf("%s-DataVolume", id)),
+			ReadOnly:      jsii.Bool(false),
+		})
+	}
+
+	// ECS stops containers in reverse dependency order, so the watchdog receives
+	// SIGTERM first and can flush the world over RCON before the server stops.
+	watchdogContainer.AddContainerDependencies(&awsecs.ContainerDependency{
+		Container: serverContainer,
+		Condition: awsecs.ContainerDependencyCondition_START,
+	})
+
 	// IAM Policies for Watchdog
 	policyID := fmt.Sprintf("%s-ServerPolicy", id)
 	serverPolicy := awsiam.NewPolicy(scope, jsii.String(policyID), &awsiam.PolicyProps{
@@ -267,13 +413,16 @@ func NewECSResources(scope constructs.Construct, id string, props *ECSResourcesP
 				Actions:   jsii.Strings("route53:GetHostedZone", "route53:ChangeResourceRecordSets", "route53:ListResourceRecordSets"),
 				Resources: jsii.Strings(fmt.Sprintf("arn:aws:route53:::hostedzone/%s", props.SubDomainHostedZoneId)),
 			}),
+			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+				Actions:   jsii.Strings("route53:GetChange"),
+				Resources: jsii.Strings("arn:aws:route53:::change/*"),
+			}),
 		},
 	})
 	serverPolicy.AttachToRole(taskRole)
 
 	return ECSResources{
 		Task:    task,
-		Cluster: cluster,
 		Service: service,
 	}
 }
@@ -1,24 +1,48 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"log"
 
 	"github.com/aws/aws-cdk-go/awscdk/v2"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsdynamodb"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsecs"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsevents"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awseventstargets"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsiam"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awslambda"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awslogs"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awslogsdestinations"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awssns"
 	"github.com/aws/constructs-go/constructs/v10"
 	"github.com/aws/jsii-runtime-go"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/capacity"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/wake"
 )
 
 type LambdaResourcesProps struct {
-	QueryLogGroup   awslogs.LogGroup
-	Cluster         awsecs.Cluster
-	Service         awsecs.FargateService
-	ServerSubDomain string
-	Domain          string
+	// QueryLogGroup triggers the launcher in the logs wake mode.
+	QueryLogGroup awslogs.LogGroup
+	Cluster       awsecs.Cluster
+	// Servers are started by the launcher, which routes each query to the
+	// server it is for.
+	Servers         []LauncherServer
+	SnsTopic        awssns.Topic
+	WakeRecordTypes string
+	ResolverFilter  ResolverFilterConfig
+	// ResolverTable stores learned resolvers, nil if learning is disabled.
+	ResolverTable awsdynamodb.Table
+	WakeMode      wake.Mode
+}
+
+// LauncherServer is a server started by the launcher.
+type LauncherServer struct {
+	// Name is the address of the server, e.g. "mc.example.com".
+	Name         string
+	Service      awsecs.FargateService
+	Edition      string
+	CapacityMode capacity.Mode
 }
 
 type LambdaResources struct {
@@ -28,6 +52,33 @@ type LambdaResources struct {
 func NewLambdaResources(scope constructs.Construct, id string, props *LambdaResourcesProps) *LambdaResources {
 	this := constructs.NewConstruct(scope, &id)
 
+	// Describe the servers for the launcher, which routes queries by name
+	var serverNames []string
+	var filterTerms []*string
+	var servers []map[string]string
+	ecsResources := jsii.Strings(
+		fmt.Sprintf("%s/*", *props.Cluster.ClusterArn()),
+		*props.Cluster.ClusterArn(),
+	)
+	for _, server := range props.Servers {
+		serverNames = append(serverNames, server.Name)
+		filterTerms = append(filterTerms, jsii.String(server.Name), jsii.String(srvName(server.Name)))
+		servers = append(servers, map[string]string{
+			"name":          server.Name,
+			"service":       *server.Service.ServiceName(),
+			"edition":       server.Edition,
+			"capacity_mode": string(server.CapacityMode),
+		})
+		*ecsResources = append(*ecsResources,
+			jsii.String(fmt.Sprintf("%s/*", *server.Service.ServiceArn())),
+			server.Service.ServiceArn(),
+		)
+	}
+	serversJSON, err := json.Marshal(servers)
+	if err != nil {
+		log.Fatalf("Failed to encode launcher servers: %v", err)
+	}
+
 	// Create IAM Role for the Lambda function
 	lambdaRole := awsiam.NewRole(this, jsii.String(fmt.Sprintf("%s-LambdaRole", id)), &awsiam.RoleProps{
 		AssumedBy: awsiam.NewServicePrincipal(jsii.String("lambda.amazonaws.com"), nil),
@@ -35,13 +86,8 @@ func NewLambdaResources(scope constructs.Construct, id string, props *LambdaReso
 			"ecsPolicy": awsiam.NewPolicyDocument(&awsiam.PolicyDocumentProps{
 				Statements: &[]awsiam.PolicyStatement{
 					awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
-						Resources: jsii.Strings(
-							fmt.Sprintf("%s/*", *props.Service.ServiceArn()),
-							*props.Service.ServiceArn(),
-							fmt.Sprintf("%s/*", *props.Cluster.ClusterArn()),
-							*props.Cluster.ClusterArn(),
-						),
-						Actions: jsii.Strings("ecs:*"),
+						Resources: ecsResources,
+						Actions:   jsii.Strings("ecs:*"),
 					}),
 				},
 			}),
@@ -53,7 +99,7 @@ func NewLambdaResources(scope constructs.Construct, id string, props *LambdaReso
 
 	// Create Lambda function using the PROVIDED_AL2023 runtime and x86_64 architecture
 	launcherLambda := awslambda.NewFunction(this, jsii.String(fmt.Sprintf("%s-LauncherLambda", id)), &awslambda.FunctionProps{
-		FunctionName: jsii.String(fmt.Sprintf("%s-LauncherLambda", id)),
+		FunctionName: jsii.String(launcherFunctionName(id)),
 		Code:         awslambda.Code_FromAsset(jsii.String("cmd/lambda/launcher"), nil),
 		Role:         lambdaRole,
 		Handler:      jsii.String("bootstrap"),
@@ -61,28 +107,69 @@ func NewLambdaResources(scope constructs.Construct, id string, props *LambdaReso
 		Architecture: awslambda.Architecture_ARM_64(),
 		LogRetention: awslogs.RetentionDays_ONE_WEEK,
 		Environment: &map[string]*string{
-			"REGION":  awscdk.Stack_Of(this).Region(),
-			"CLUSTER": props.Cluster.ClusterName(),
-			"SERVICE": props.Service.ServiceName(),
+			"REGION":   awscdk.Stack_Of(this).Region(),
+			"CLUSTER":  props.Cluster.ClusterName(),
+			"SERVERS":  jsii.String(string(serversJSON)),
+			"SNSTOPIC": props.SnsTopic.TopicArn(),
+
+			"WAKE_RECORD_TYPES":    jsii.String(props.WakeRecordTypes),
+			"ALLOW_RESOLVER_CIDRS": jsii.String(props.ResolverFilter.AllowCIDRs),
+			"DENY_RESOLVER_CIDRS":  jsii.String(props.ResolverFilter.DenyCIDRs),
+			"ALLOW_EDGE_LOCATIONS": jsii.String(props.ResolverFilter.EdgeLocations),
 		},
 	})
 
-	// Add permissions for CloudWatch Logs to invoke Lambda
-	launcherLambda.AddPermission(jsii.String("InvokeLambda"), &awslambda.Permission{
-		Principal: awsiam.NewServicePrincipal(
-			jsii.String(fmt.Sprintf("logs.%s.amazonaws.com", *awscdk.Stack_Of(this).Region())), nil),
-		Action:        jsii.String("lambda:InvokeFunction"),
-		SourceArn:     props.QueryLogGroup.LogGroupArn(),
-		SourceAccount: awscdk.Stack_Of(this).Account(),
-	})
+	// Allow the launcher to announce that the server is starting
+	props.SnsTopic.GrantPublish(launcherLambda)
 
-	// Add CloudWatch Logs subscription filter
-	props.QueryLogGroup.AddSubscriptionFilter(jsii.String(fmt.Sprintf("%s-SubscriptionFilter", id)), &awslogs.SubscriptionFilterOptions{
-		Destination:   awslogsdestinations.NewLambdaDestination(launcherLambda, &awslogsdestinations.LambdaDestinationOptions{}),
-		FilterPattern: awslogs.FilterPattern_AllTerms(jsii.String(fmt.Sprintf("%s.%s", props.ServerSubDomain, props.Domain))),
-	})
+	if props.ResolverTable != nil {
+		props.ResolverTable.GrantReadWriteData(launcherLambda)
+		launcherLambda.AddEnvironment(jsii.String("RESOLVER_TABLE"), props.ResolverTable.TableName(), nil)
+	}
+
+	switch props.WakeMode {
+	case wake.EventBridge:
+		// Invoke the launcher for wake requests the forwarder sends to the
+		// default event bus
+		awsevents.NewRule(this, jsii.String(fmt.Sprintf("%s-WakeRule", id)), &awsevents.RuleProps{
+			EventPattern: &awsevents.EventPattern{
+				Source:     jsii.Strings(wake.Source),
+				DetailType: jsii.Strings(wake.DetailType),
+				Detail: &map[string]interface{}{
+					"server": serverNames,
+				},
+			},
+			Targets: &[]awsevents.IRuleTarget{
+				awseventstargets.NewLambdaFunction(launcherLambda, &awseventstargets.LambdaFunctionProps{}),
+			},
+		})
+	case wake.Invoke:
+		// The forwarder role is allowed to invoke the launcher by name, see
+		// NewQueryLogStack
+	default:
+		// Add permissions for CloudWatch Logs to invoke Lambda
+		launcherLambda.AddPermission(jsii.String("InvokeLambda"), &awslambda.Permission{
+			Principal: awsiam.NewServicePrincipal(
+				jsii.String(fmt.Sprintf("logs.%s.amazonaws.com", *awscdk.Stack_Of(this).Region())), nil),
+			Action:        jsii.String("lambda:InvokeFunction"),
+			SourceArn:     props.QueryLogGroup.LogGroupArn(),
+			SourceAccount: awscdk.Stack_Of(this).Account(),
+		})
+
+		// Add CloudWatch Logs subscription filter
+		props.QueryLogGroup.AddSubscriptionFilter(jsii.String(fmt.Sprintf("%s-SubscriptionFilter", id)), &awslogs.SubscriptionFilterOptions{
+			Destination:   awslogsdestinations.NewLambdaDestination(launcherLambda, &awslogsdestinations.LambdaDestinationOptions{}),
+			FilterPattern: awslogs.FilterPattern_AnyTerm(filterTerms...),
+		})
+	}
 
 	return &LambdaResources{
 		Construct: this,
 	}
 }
+
+// launcherFunctionName returns the name of the launcher function created by
+// NewLambdaResources with id.
+func launcherFunctionName(id string) string {
+	return fmt.Sprintf("%s-LauncherLambda", id)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-cdk-go/awscdk/v2"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsdynamodb"
+	"github.com/aws/constructs-go/constructs/v10"
+	"github.com/aws/jsii-runtime-go"
+)
+
+// NewResolverTable creates the table of resolvers whose queries led to player
+// sessions. The launcher records wakeups, the watchdog learns resolvers.
+func NewResolverTable(scope constructs.Construct, id string) awsdynamodb.Table {
+	tableID := fmt.Sprintf("%s-ResolverTable", id)
+	return awsdynamodb.NewTable(scope, jsii.String(tableID), &awsdynamodb.TableProps{
+		PartitionKey:        &awsdynamodb.Attribute{Name: jsii.String("resolver"), Type: awsdynamodb.AttributeType_STRING},
+		BillingMode:         awsdynamodb.BillingMode_PAY_PER_REQUEST,
+		TimeToLiveAttribute: jsii.String("expires_at"),
+		RemovalPolicy:       awscdk.RemovalPolicy_DESTROY,
+	})
+}
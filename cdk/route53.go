@@ -9,6 +9,7 @@ import (
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsroute53"
 	"github.com/aws/constructs-go/constructs/v10"
 	"github.com/aws/jsii-runtime-go"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/wake"
 )
 
 type Route53ResourcesProps struct {
@@ -16,46 +17,62 @@ type Route53ResourcesProps struct {
 	Domain             string
 	HostedZoneId       string
 	UsEast1LogGroupArn string
+	WakeMode           wake.Mode
+	ParkingIP          string
+	SrvPort            int
+	// Primary creates the resources shared by all servers, the forwarded
+	// query log group and the resource policy. It is set for the first
+	// server, whose name the log group is named after.
+	Primary bool
 }
 
 type Route53Resources struct {
 	constructs.Construct
+	// QueryLogGroup receives the forwarded query logs of all servers, nil
+	// unless the wake mode is logs and the server is the primary one.
 	QueryLogGroup   awslogs.LogGroup
 	SubDomainZoneId string
+	ParkingIP       string
 }
 
 func NewRoute53Resources(scope constructs.Construct, id string, props *Route53ResourcesProps) *Route53Resources {
 	this := constructs.NewConstruct(scope, &id)
+	name := serverName(props.ServerSubDomain, props.Domain)
 
-	// Create the log group for Route53 query logs
-	logGroupName := fmt.Sprintf("/aws/route53/%s.%s", props.ServerSubDomain, props.Domain)
-	queryLogGroup := awslogs.NewLogGroup(this, jsii.String(fmt.Sprintf("%s-QueryLogGroup", id)), &awslogs.LogGroupProps{
-		LogGroupName:  jsii.String(logGroupName),
-		Retention:     awslogs.RetentionDays_THREE_DAYS,
-		RemovalPolicy: awscdk.RemovalPolicy_DESTROY,
-	})
+	// Create the log group the forwarder copies Route53 query logs to
+	var queryLogGroup awslogs.LogGroup
+	if props.Primary && props.WakeMode == wake.Logs {
+		logGroupName := fmt.Sprintf("/aws/route53/%s", name)
+		queryLogGroup = awslogs.NewLogGroup(this, jsii.String(fmt.Sprintf("%s-QueryLogGroup", id)), &awslogs.LogGroupProps{
+			LogGroupName:  jsii.String(logGroupName),
+			Retention:     awslogs.RetentionDays_THREE_DAYS,
+			RemovalPolicy: awscdk.RemovalPolicy_DESTROY,
+		})
+	}
 
 	// Update the resource policy to allow Route 53 to write to the log group in us-east-1
-	resourcePolicyName := fmt.Sprintf("%s-Route53ResourcePolicy", id)
-	awslogs.NewResourcePolicy(this, jsii.String(resourcePolicyName), &awslogs.ResourcePolicyProps{
-		ResourcePolicyName: jsii.String(resourcePolicyName),
-		PolicyStatements: &[]awsiam.PolicyStatement{
-			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
-				Principals: &[]awsiam.IPrincipal{
-					awsiam.NewServicePrincipal(jsii.String("route53.amazonaws.com"), nil),
-				},
-				Actions: &[]*string{
-					jsii.String("logs:CreateLogStream"),
-					jsii.String("logs:PutLogEvents"),
-					jsii.String("logs:DescribeLogStreams"),
-					jsii.String("logs:CreateLogGroup"),
-				},
-				Resources: &[]*string{
-					jsii.String(fmt.Sprintf("%s:*", props.UsEast1LogGroupArn)),
-				},
-			}),
-		},
-	})
+	if props.Primary {
+		resourcePolicyName := fmt.Sprintf("%s-Route53ResourcePolicy", id)
+		awslogs.NewResourcePolicy(this, jsii.String(resourcePolicyName), &awslogs.ResourcePolicyProps{
+			ResourcePolicyName: jsii.String(resourcePolicyName),
+			PolicyStatements: &[]awsiam.PolicyStatement{
+				awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+					Principals: &[]awsiam.IPrincipal{
+						awsiam.NewServicePrincipal(jsii.String("route53.amazonaws.com"), nil),
+					},
+					Actions: &[]*string{
+						jsii.String("logs:CreateLogStream"),
+						jsii.String("logs:PutLogEvents"),
+						jsii.String("logs:DescribeLogStreams"),
+						jsii.String("logs:CreateLogGroup"),
+					},
+					Resources: &[]*string{
+						jsii.String(fmt.Sprintf("%s:*", props.UsEast1LogGroupArn)),
+					},
+				}),
+			},
+		})
+	}
 
 	// Reference the hosted zone
 	hostedZone := awsroute53.HostedZone_FromHostedZoneAttributes(this, jsii.String(fmt.Sprintf("%s-HostedZone", id)), &awsroute53.HostedZoneAttributes{
@@ -66,7 +83,7 @@ func NewRoute53Resources(scope constructs.Construct, id string, props *Route53Re
 	// Create a hosted zone for the subdomain
 	subdomainHostedZoneName := fmt.Sprintf("%s-SubdomainHostedZone", id)
 	subdomainHostedZone := awsroute53.NewHostedZone(this, jsii.String(subdomainHostedZoneName), &awsroute53.HostedZoneProps{
-		ZoneName:             jsii.String(fmt.Sprintf("%s.%s", props.ServerSubDomain, props.Domain)),
+		ZoneName:             jsii.String(name),
 		QueryLogsLogGroupArn: &props.UsEast1LogGroupArn,
 	})
 
@@ -75,21 +92,52 @@ func NewRoute53Resources(scope constructs.Construct, id string, props *Route53Re
 	awsroute53.NewNsRecord(this, jsii.String(nsRecordName), &awsroute53.NsRecordProps{
 		Zone:       hostedZone,
 		Values:     subdomainHostedZone.HostedZoneNameServers(),
-		RecordName: jsii.String(fmt.Sprintf("%s.%s", props.ServerSubDomain, props.Domain)),
+		RecordName: jsii.String(name),
 	})
 
-	// Create an A record for the subdomain
+	// Create an A record for the subdomain. It points to the parking IP while
+	// the server is stopped, the watchdog restores it on shutdown.
 	aRecordName := fmt.Sprintf("%s-ARecord", id)
 	awsroute53.NewARecord(this, jsii.String(aRecordName), &awsroute53.ARecordProps{
 		Zone:       subdomainHostedZone,
-		Target:     awsroute53.RecordTarget_FromIpAddresses(jsii.String("192.168.1.1")),
+		Target:     awsroute53.RecordTarget_FromIpAddresses(jsii.String(props.ParkingIP)),
 		Ttl:        awscdk.Duration_Seconds(jsii.Number(30)),
-		RecordName: jsii.String(fmt.Sprintf("%s.%s", props.ServerSubDomain, props.Domain)),
+		RecordName: jsii.String(name),
 	})
 
+	// Create an SRV record so Java clients find the server on a non-standard
+	// port. The watchdog keeps it in sync when the task starts.
+	if props.SrvPort != 0 {
+		srvRecordName := fmt.Sprintf("%s-SrvRecord", id)
+		awsroute53.NewSrvRecord(this, jsii.String(srvRecordName), &awsroute53.SrvRecordProps{
+			Zone:       subdomainHostedZone,
+			RecordName: jsii.String(srvName(name)),
+			Ttl:        awscdk.Duration_Seconds(jsii.Number(30)),
+			Values: &[]*awsroute53.SrvRecordValue{
+				{
+					Priority: jsii.Number(0),
+					Weight:   jsii.Number(5),
+					Port:     jsii.Number(props.SrvPort),
+					HostName: jsii.String(name),
+				},
+			},
+		})
+	}
+
 	return &Route53Resources{
 		Construct:       this,
 		QueryLogGroup:   queryLogGroup,
 		SubDomainZoneId: *subdomainHostedZone.HostedZoneId(),
+		ParkingIP:       props.ParkingIP,
 	}
 }
+
+// serverName returns the address of a server, e.g. "mc.example.com".
+func serverName(subDomain, domain string) string {
+	return fmt.Sprintf("%s.%s", subDomain, domain)
+}
+
+// srvName returns the name of the SRV record Java clients look up for the server.
+func srvName(serverName string) string {
+	return fmt.Sprintf("_minecraft._tcp.%s", serverName)
+}
@@ -3,14 +3,29 @@ package main
 import (
 	"fmt"
 
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsevents"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awseventstargets"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awssns"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awssnssubscriptions"
 	"github.com/aws/constructs-go/constructs/v10"
 	"github.com/aws/jsii-runtime-go"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/notify"
 )
 
+// SNSSubscription subscribes an endpoint to the notification topic. Email
+// endpoints receive plain text, HTTPS endpoints the JSON payload.
+type SNSSubscription struct {
+	Protocol awssns.SubscriptionProtocol
+	Endpoint string
+	// EventTypes limits the subscription to these events, all if empty.
+	EventTypes []notify.Event
+}
+
 type SNSResourcesProps struct {
-	SnsEmail string
+	Subscriptions []SNSSubscription
+	// AlarmNames are alarms in other regions whose state changes arrive on
+	// the default event bus and are published to the topic.
+	AlarmNames []string
 }
 
 type SNSResources struct {
@@ -26,11 +41,64 @@ func NewSNSResources(scope constructs.Construct, id string, props *SNSResourcesP
 		TopicName: jsii.String(snsTopicID),
 	})
 
-	emailSubscription := awssnssubscriptions.NewEmailSubscription(jsii.String(props.SnsEmail), &awssnssubscriptions.EmailSubscriptionProps{})
-	snsTopic.AddSubscription(emailSubscription)
+	for _, subscription := range props.Subscriptions {
+		filterPolicy := eventTypeFilter(subscription.EventTypes)
+		switch subscription.Protocol {
+		case awssns.SubscriptionProtocol_EMAIL:
+			snsTopic.AddSubscription(awssnssubscriptions.NewEmailSubscription(jsii.String(subscription.Endpoint), &awssnssubscriptions.EmailSubscriptionProps{
+				FilterPolicy: filterPolicy,
+			}))
+		case awssns.SubscriptionProtocol_HTTPS:
+			snsTopic.AddSubscription(awssnssubscriptions.NewUrlSubscription(jsii.String(subscription.Endpoint), &awssnssubscriptions.UrlSubscriptionProps{
+				Protocol:     awssns.SubscriptionProtocol_HTTPS,
+				FilterPolicy: filterPolicy,
+			}))
+		}
+	}
+
+	// Publish alarms that fire as plain text. EventBridge cannot set message
+	// attributes, so subscriptions filtered by event type do not receive them.
+	if len(props.AlarmNames) > 0 {
+		awsevents.NewRule(this, jsii.String(fmt.Sprintf("%s-AlarmRule", id)), &awsevents.RuleProps{
+			EventPattern: &awsevents.EventPattern{
+				Source:     jsii.Strings("aws.cloudwatch"),
+				DetailType: jsii.Strings("CloudWatch Alarm State Change"),
+				Detail: &map[string]interface{}{
+					"alarmName": props.AlarmNames,
+					"state":     map[string]interface{}{"value": []string{"ALARM"}},
+				},
+			},
+			Targets: &[]awsevents.IRuleTarget{
+				awseventstargets.NewSnsTopic(snsTopic, &awseventstargets.SnsTopicProps{
+					Message: awsevents.RuleTargetInput_FromText(jsii.String(fmt.Sprintf("Alarm %s in %s: %s",
+						*awsevents.EventField_FromPath(jsii.String("$.detail.alarmName")),
+						*awsevents.EventField_FromPath(jsii.String("$.region")),
+						*awsevents.EventField_FromPath(jsii.String("$.detail.state.reason")),
+					))),
+				}),
+			},
+		})
+	}
 
 	return &SNSResources{
 		Construct: this,
 		SnsTopic:  snsTopic,
 	}
 }
+
+// eventTypeFilter returns a filter policy on the event_type message attribute,
+// or nil to receive all events.
+func eventTypeFilter(events []notify.Event) *map[string]awssns.SubscriptionFilter {
+	if len(events) == 0 {
+		return nil
+	}
+	allowlist := make([]*string, 0, len(events))
+	for _, event := range events {
+		allowlist = append(allowlist, jsii.String(string(event)))
+	}
+	return &map[string]awssns.SubscriptionFilter{
+		notify.AttributeEventType: awssns.SubscriptionFilter_StringFilter(&awssns.StringConditions{
+			Allowlist: &allowlist,
+		}),
+	}
+}
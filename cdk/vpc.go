@@ -9,7 +9,10 @@ import (
 )
 
 type VPCResourcesProps struct {
-	IngressRule awsec2.Port
+	// IngressRules are the ports of all servers. They share the security
+	// group, as each task has its own address.
+	IngressRules []awsec2.Port
+	EnableIPv6   bool
 }
 
 type VPCResources struct {
@@ -21,38 +24,58 @@ type VPCResources struct {
 func NewVPCResources(scope constructs.Construct, id string, props *VPCResourcesProps) *VPCResources {
 	this := constructs.NewConstruct(scope, &id)
 
+	// Use a dual-stack VPC if IPv6 is enabled, public subnets then get an
+	// IPv6 CIDR and assign IPv6 addresses to tasks on launch. CDK rejects the
+	// IPv6 subnet setting in an IPv4 only VPC, even if it is false.
+	ipProtocol := awsec2.IpProtocol_IPV4_ONLY
+	publicSubnet := &awsec2.SubnetConfiguration{
+		CidrMask:            jsii.Number(24),
+		Name:                jsii.String(fmt.Sprintf("%s-PublicSubnet", id)),
+		SubnetType:          awsec2.SubnetType_PUBLIC,
+		MapPublicIpOnLaunch: jsii.Bool(true),
+	}
+	if props.EnableIPv6 {
+		ipProtocol = awsec2.IpProtocol_DUAL_STACK
+		publicSubnet.Ipv6AssignAddressOnCreation = jsii.Bool(true)
+	}
+
 	// Create VPC
 	vpcID := fmt.Sprintf("%s-VPC", id)
 	vpc := awsec2.NewVpc(this, jsii.String(vpcID), &awsec2.VpcProps{
-		VpcName:     jsii.String(vpcID),
-		NatGateways: jsii.Number(0),
-		SubnetConfiguration: &[]*awsec2.SubnetConfiguration{
-			{
-				CidrMask:            jsii.Number(24),
-				Name:                jsii.String(fmt.Sprintf("%s-PublicSubnet", id)),
-				SubnetType:          awsec2.SubnetType_PUBLIC,
-				MapPublicIpOnLaunch: jsii.Bool(true),
-			},
-		},
-		MaxAzs: jsii.Number(2),
+		VpcName:             jsii.String(vpcID),
+		NatGateways:         jsii.Number(0),
+		IpProtocol:          ipProtocol,
+		SubnetConfiguration: &[]*awsec2.SubnetConfiguration{publicSubnet},
+		MaxAzs:              jsii.Number(2),
 	})
 
 	// Create Security Group
 	sgID := fmt.Sprintf("%s-SecurityGroup", id)
 	sg := awsec2.NewSecurityGroup(this, jsii.String(sgID), &awsec2.SecurityGroupProps{
-		Vpc:               vpc,
-		SecurityGroupName: jsii.String(sgID),
-		Description:       jsii.String("Security Group for server"),
-		AllowAllOutbound:  jsii.Bool(true),
+		Vpc:                  vpc,
+		SecurityGroupName:    jsii.String(sgID),
+		Description:          jsii.String("Security Group for server"),
+		AllowAllOutbound:     jsii.Bool(true),
+		AllowAllIpv6Outbound: jsii.Bool(props.EnableIPv6),
 	})
 
-	// Add ingress rule
-	sg.AddIngressRule(
-		awsec2.Peer_AnyIpv4(),
-		props.IngressRule,
-		jsii.String(fmt.Sprintf("%s-AllowServerTraffic", id)),
-		jsii.Bool(false),
-	)
+	// Add ingress rules, servers on the same port share them
+	for _, ingressRule := range props.IngressRules {
+		sg.AddIngressRule(
+			awsec2.Peer_AnyIpv4(),
+			ingressRule,
+			jsii.String(fmt.Sprintf("%s-AllowServerTraffic", id)),
+			jsii.Bool(false),
+		)
+		if props.EnableIPv6 {
+			sg.AddIngressRule(
+				awsec2.Peer_AnyIpv6(),
+				ingressRule,
+				jsii.String(fmt.Sprintf("%s-AllowServerTrafficIpv6", id)),
+				jsii.Bool(false),
+			)
+		}
+	}
 
 	return &VPCResources{
 		Construct:     this,
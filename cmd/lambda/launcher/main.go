@@ -1,33 +1,103 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/alexflint/go-arg"
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/capacity"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/notify"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/querylog"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/resolvers"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/wake"
 )
 
+// DefaultWakeRecordTypes are the record types Minecraft clients look up to
+// connect. NS, SOA or TXT lookups come from scanners and monitoring.
+var DefaultWakeRecordTypes = []string{"A", "AAAA", "SRV"}
+
 type Config struct {
-	Region  string `arg:"env:REGION,required" help:"AWS region where ECS cluster is located"`
-	Cluster string `arg:"env:CLUSTER,required" help:"ECS cluster name"`
-	Service string `arg:"env:SERVICE,required" help:"ECS service name"`
+	Region  string  `arg:"env:REGION,required" help:"AWS region where ECS cluster is located"`
+	Cluster string  `arg:"env:CLUSTER,required" help:"ECS cluster name"`
+	Servers Servers `arg:"env:SERVERS" help:"JSON list of the servers in the cluster, by name, service, edition and capacity_mode"`
+
+	// A single server can be configured instead of SERVERS
+	Service      string `arg:"env:SERVICE" help:"ECS service name, if SERVERS is unset"`
+	CapacityMode string `arg:"env:CAPACITY_MODE" default:"fargate" help:"Capacity mode: fargate, spot or spot-fallback, if SERVERS is unset"`
+
+	WakeRecordTypes []string `arg:"env:WAKE_RECORD_TYPES" help:"Queried record types that start the server, e.g. A,AAAA,SRV"`
+
+	AllowResolverCIDRs []string `arg:"env:ALLOW_RESOLVER_CIDRS" help:"Resolver CIDRs allowed to start the server"`
+	DenyResolverCIDRs  []string `arg:"env:DENY_RESOLVER_CIDRS" help:"Resolver CIDRs never allowed to start the server"`
+	AllowEdgeLocations []string `arg:"env:ALLOW_EDGE_LOCATIONS" help:"Route53 edge locations (e.g. FRA) or countries (e.g. DE) allowed to start the server"`
+	ResolverTable      string   `arg:"env:RESOLVER_TABLE" help:"DynamoDB table of learned resolvers, learning is disabled if unset"`
+
+	SNSTopic   string `arg:"env:SNSTOPIC" help:"SNS topic the starting notification is published to"`
+	ServerName string `arg:"env:SERVERNAME" help:"Address of the server shown in notifications, if SERVERS is unset"`
+	Edition    string `arg:"env:EDITION" help:"Server edition shown in notifications, if SERVERS is unset"`
+}
+
+// ServerConfig is an entry of SERVERS.
+type ServerConfig struct {
+	// Name is the address of the server, e.g. "mc.example.com". Queries are
+	// routed to the server by it.
+	Name         string `json:"name"`
+	Service      string `json:"service"`
+	Edition      string `json:"edition"`
+	CapacityMode string `json:"capacity_mode"`
+}
+
+// Servers is the JSON list of servers in SERVERS.
+type Servers []ServerConfig
+
+// UnmarshalText decodes the JSON list.
+func (s *Servers) UnmarshalText(text []byte) error {
+	return json.Unmarshal(text, (*[]ServerConfig)(s))
+}
+
+// Server is a server the launcher starts.
+type Server struct {
+	Name         string
+	Service      string
+	Edition      string
+	CapacityMode capacity.Mode
+	// Resolvers records wakeups of the server and looks up learned
+	// resolvers. It is nil if learning is disabled.
+	Resolvers *resolvers.Store
 }
 
 type LambdaHandler struct {
 	Config    Config
 	Logger    *slog.Logger
 	EcsClient *ecs.Client
+	Servers   []*Server
+	// WakeRecordTypes holds the upper-case record types that start the server.
+	WakeRecordTypes map[string]bool
+	Filter          *resolvers.Filter
+	// Notifier publishes the starting notification. It is nil if no topic
+	// is configured.
+	Notifier notify.Notifier
 }
 
 // NewLambdaHandler initializes a new LambdaHandler.
 func NewLambdaHandler() *LambdaHandler {
 	// Parse environment variables
-	var cfg Config
+	cfg := Config{WakeRecordTypes: DefaultWakeRecordTypes}
 	arg.MustParse(&cfg)
 
 	// Setup structured logging
@@ -43,62 +113,361 @@ func NewLambdaHandler() *LambdaHandler {
 	// Create ECS client
 	ecsClient := ecs.NewFromConfig(awsCfg)
 
+	filter, err := resolvers.NewFilter(cfg.AllowResolverCIDRs, cfg.DenyResolverCIDRs, cfg.AllowEdgeLocations)
+	if err != nil {
+		logger.Error("Invalid resolver filter", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	var dynamodbClient *dynamodb.Client
+	if cfg.ResolverTable != "" {
+		dynamodbClient = dynamodb.NewFromConfig(awsCfg)
+	}
+	servers, err := newServers(cfg, dynamodbClient)
+	if err != nil {
+		logger.Error("Invalid servers", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	var notifier notify.Notifier
+	if cfg.SNSTopic != "" {
+		notifier = &notify.SNS{Client: sns.NewFromConfig(awsCfg), TopicARN: cfg.SNSTopic}
+	}
+
+	wakeRecordTypes := make(map[string]bool, len(cfg.WakeRecordTypes))
+	for _, rrType := range cfg.WakeRecordTypes {
+		wakeRecordTypes[strings.ToUpper(strings.TrimSpace(rrType))] = true
+	}
+
 	return &LambdaHandler{
-		Config:    cfg,
-		Logger:    logger,
-		EcsClient: ecsClient,
+		Config:          cfg,
+		Logger:          logger,
+		EcsClient:       ecsClient,
+		Servers:         servers,
+		WakeRecordTypes: wakeRecordTypes,
+		Filter:          filter,
+		Notifier:        notifier,
+	}
+}
+
+// newServers returns the servers of SERVERS, or the single server configured
+// by SERVICE if it is unset. The resolver store of each server is nil if
+// dynamodbClient is.
+func newServers(cfg Config, dynamodbClient *dynamodb.Client) ([]*Server, error) {
+	configs := cfg.Servers
+	if len(configs) == 0 {
+		if cfg.Service == "" {
+			return nil, errors.New("SERVERS or SERVICE is required")
+		}
+		configs = Servers{{Name: cfg.ServerName, Service: cfg.Service, Edition: cfg.Edition, CapacityMode: cfg.CapacityMode}}
+	}
+
+	servers := make([]*Server, 0, len(configs))
+	names := make(map[string]bool, len(configs))
+	for _, c := range configs {
+		if c.Service == "" {
+			return nil, fmt.Errorf("server %q has no service", c.Name)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate server %q", c.Name)
+		}
+		names[c.Name] = true
+
+		mode, err := capacity.ParseMode(cmp.Or(c.CapacityMode, string(capacity.Fargate)))
+		if err != nil {
+			return nil, fmt.Errorf("server %q: %w", c.Name, err)
+		}
+		server := &Server{Name: c.Name, Service: c.Service, Edition: c.Edition, CapacityMode: mode}
+		if dynamodbClient != nil {
+			server.Resolvers = &resolvers.Store{Client: dynamodbClient, Table: cfg.ResolverTable, Service: c.Service}
+		}
+		servers = append(servers, server)
 	}
+	return servers, nil
 }
 
 // DescribeService retrieves the ECS service information.
-func (h *LambdaHandler) DescribeService(ctx context.Context) (*ecs.DescribeServicesOutput, error) {
+func (h *LambdaHandler) DescribeService(ctx context.Context, service string) (*ecs.DescribeServicesOutput, error) {
 	return h.EcsClient.DescribeServices(ctx, &ecs.DescribeServicesInput{
 		Cluster:  aws.String(h.Config.Cluster),
-		Services: []string{h.Config.Service},
+		Services: []string{service},
 	})
 }
 
 // UpdateDesiredCount updates the desired count of the ECS service.
-func (h *LambdaHandler) UpdateDesiredCount(ctx context.Context, count int32) error {
+func (h *LambdaHandler) UpdateDesiredCount(ctx context.Context, service string, count int32) error {
 	_, err := h.EcsClient.UpdateService(ctx, &ecs.UpdateServiceInput{
 		Cluster:      aws.String(h.Config.Cluster),
-		Service:      aws.String(h.Config.Service),
+		Service:      aws.String(service),
 		DesiredCount: aws.Int32(count),
 	})
 	return err
 }
 
-// HandleRequest processes the Lambda event.
-func (h *LambdaHandler) HandleRequest(ctx context.Context) error {
-	// Describe ECS service
-	describeServicesOutput, err := h.DescribeService(ctx)
+// StartOnProvider sets the desired count to one and moves the service to the
+// capacity provider. Changing the strategy requires a new deployment.
+func (h *LambdaHandler) StartOnProvider(ctx context.Context, service, provider string) error {
+	_, err := h.EcsClient.UpdateService(ctx, &ecs.UpdateServiceInput{
+		Cluster:                  aws.String(h.Config.Cluster),
+		Service:                  aws.String(service),
+		DesiredCount:             aws.Int32(1),
+		CapacityProviderStrategy: capacity.Strategy(provider),
+		ForceNewDeployment:       true,
+	})
+	return err
+}
+
+// invocation holds the fields telling the payloads the launcher accepts apart:
+// a CloudWatch Logs subscription payload, an EventBridge event carrying a
+// wake.Request, or a wake.Request invoked directly.
+type invocation struct {
+	AWSLogs    events.CloudwatchLogsRawData `json:"awslogs"`
+	DetailType string                       `json:"detail-type"`
+	Detail     json.RawMessage              `json:"detail"`
+}
+
+// logEvents returns the query log records of payload.
+func logEvents(payload json.RawMessage) ([]events.CloudwatchLogsLogEvent, error) {
+	var inv invocation
+	if err := json.Unmarshal(payload, &inv); err != nil {
+		return nil, fmt.Errorf("failed to decode payload: %w", err)
+	}
+	switch {
+	case inv.AWSLogs.Data != "":
+		data, err := inv.AWSLogs.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode CloudWatch Logs payload: %w", err)
+		}
+		return data.LogEvents, nil
+	case inv.DetailType != "":
+		if inv.DetailType != wake.DetailType {
+			return nil, fmt.Errorf("unexpected event detail type %q", inv.DetailType)
+		}
+		var request wake.Request
+		if err := json.Unmarshal(inv.Detail, &request); err != nil {
+			return nil, fmt.Errorf("failed to decode %s event: %w", wake.DetailType, err)
+		}
+		return request.Records, nil
+	}
+
+	// The envelope of an EventBridge event has a string version, so a direct
+	// wake request is only decoded once the other payloads are ruled out.
+	var request wake.Request
+	if err := json.Unmarshal(payload, &request); err != nil || request.Version == 0 {
+		return nil, errors.New("unsupported payload, want CloudWatch Logs data or a wake request")
+	}
+	return request.Records, nil
+}
+
+// HandleRequest processes a batch of Route53 query log records, delivered by
+// a CloudWatch Logs subscription or sent by the forwarder as a wake request.
+// Each record is routed to the server it queries, which is started if any of
+// its records is a query for one of the wake record types from an accepted
+// resolver.
+func (h *LambdaHandler) HandleRequest(ctx context.Context, payload json.RawMessage) error {
+	records, err := logEvents(payload)
 	if err != nil {
-		h.Logger.Error("Failed to describe ECS service", slog.String("error", err.Error()))
+		h.Logger.Error("Failed to decode query log records", slog.String("error", err.Error()))
 		return err
 	}
 
-	if len(describeServicesOutput.Services) == 0 {
-		h.Logger.Error("No services found", slog.String("cluster", h.Config.Cluster), slog.String("service", h.Config.Service))
+	wakeups := h.wakeRecords(ctx, records)
+	if len(wakeups) == 0 {
+		h.Logger.Info("No query log record requires a server", slog.Int("records", len(records)))
+		return nil
+	}
+	var errs []error
+	for _, w := range wakeups {
+		if err := h.wake(ctx, w.server, w.record); err != nil {
+			errs = append(errs, fmt.Errorf("failed to start %s: %w", w.server.Service, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// wake starts server for the query of record.
+func (h *LambdaHandler) wake(ctx context.Context, server *Server, record querylog.Record) error {
+	h.Logger.Info("Starting server for query", append(recordAttrs(record), slog.String("service", server.Service))...)
+	started, err := h.StartServer(ctx, server)
+	if err != nil {
 		return err
 	}
 
+	if !started {
+		return nil
+	}
+	h.sendStartingNotification(ctx, server, record)
+
+	// The watchdog learns this resolver once a player joins.
+	if server.Resolvers != nil {
+		if err := server.Resolvers.RecordWake(ctx, record.ResolverIP, time.Now()); err != nil {
+			h.Logger.Error("Failed to record wakeup", slog.String("service", server.Service), slog.String("error", err.Error()))
+		}
+	}
+	return nil
+}
+
+// sendStartingNotification tells players the server is on its way, minutes
+// before the watchdog reports it online. Failures are logged only, as the
+// server is starting either way.
+func (h *LambdaHandler) sendStartingNotification(ctx context.Context, server *Server, record querylog.Record) {
+	if h.Notifier == nil {
+		return
+	}
+	n := notify.Notification{
+		Event:   notify.EventStarting,
+		Title:   "Server is starting.",
+		Service: server.Service,
+		Edition: server.Edition,
+		Address: server.Name,
+		Fields: []notify.Field{
+			{Name: "Service", Value: server.Service},
+			{Name: "Address", Value: server.Name},
+			{Name: "Requested at", Value: record.Time.Format(time.RFC1123)},
+			{Name: "Query", Value: fmt.Sprintf("%s %s", record.Name, record.Type)},
+			{Name: "Resolver", Value: fmt.Sprintf("%s via %s", record.ResolverIP, record.EdgeLocation)},
+		},
+		Time: time.Now(),
+	}
+	if err := h.Notifier.Notify(ctx, n); err != nil {
+		h.Logger.Error("Failed to send starting notification", slog.String("sink", h.Notifier.Name()), slog.String("error", err.Error()))
+	}
+}
+
+// wakeup is a query log record that should start server.
+type wakeup struct {
+	server *Server
+	record querylog.Record
+}
+
+// wakeRecords returns the first record that should start a server, for each
+// server queried. Every record of a server before it is rejected, logged and
+// counted.
+func (h *LambdaHandler) wakeRecords(ctx context.Context, logEvents []events.CloudwatchLogsLogEvent) []wakeup {
+	var wakeups []wakeup
+	woken := make(map[*Server]bool)
+	for _, logEvent := range logEvents {
+		record, err := querylog.Parse(logEvent.Message)
+		if err != nil {
+			h.rejectWakeup(h.singleServer(), rejectInvalidRecord, slog.String("eventID", logEvent.ID), slog.String("error", err.Error()))
+			continue
+		}
+		server, ok := h.route(record)
+		if !ok {
+			h.rejectWakeup(nil, rejectUnknownServer, recordAttrs(record)...)
+			continue
+		}
+		if woken[server] {
+			continue
+		}
+		if !h.WakeRecordTypes[record.Type] {
+			h.rejectWakeup(server, rejectRecordType, recordAttrs(record)...)
+			continue
+		}
+		if ok, reason := h.acceptResolver(ctx, server, record); !ok {
+			h.rejectWakeup(server, reason, recordAttrs(record)...)
+			continue
+		}
+		woken[server] = true
+		wakeups = append(wakeups, wakeup{server: server, record: record})
+	}
+	return wakeups
+}
+
+// route returns the server record queries.
+func (h *LambdaHandler) route(record querylog.Record) (*Server, bool) {
+	names := make([]string, len(h.Servers))
+	for i, server := range h.Servers {
+		names[i] = server.Name
+	}
+	name, ok := wake.MatchServer(record.Name, names)
+	if !ok {
+		return nil, false
+	}
+	return h.Servers[slices.Index(names, name)], true
+}
+
+// singleServer returns the server if there is only one, records that cannot
+// be routed are attributed to it. It returns nil otherwise.
+func (h *LambdaHandler) singleServer() *Server {
+	if len(h.Servers) == 1 {
+		return h.Servers[0]
+	}
+	return nil
+}
+
+// acceptResolver applies the resolver filter to record. Resolvers rejected
+// only for not matching an allow rule are accepted if they were learned.
+func (h *LambdaHandler) acceptResolver(ctx context.Context, server *Server, record querylog.Record) (bool, string) {
+	ok, reason := h.Filter.Decide(record.ResolverIP, record.EdgeLocation)
+	if ok || reason != resolvers.ReasonNotAllowed || server.Resolvers == nil {
+		return ok, reason
+	}
+	learned, err := server.Resolvers.Learned(ctx, record.ResolverIP, time.Now())
+	if err != nil {
+		h.Logger.Error("Failed to look up learned resolver", slog.String("error", err.Error()))
+		return false, reason
+	}
+	if learned {
+		h.Logger.Info("Accepting learned resolver", slog.String("resolver", record.ResolverIP.String()))
+		return true, ""
+	}
+	return false, reason
+}
+
+// recordAttrs returns the log attributes describing record.
+func recordAttrs(record querylog.Record) []any {
+	return []any{
+		slog.String("name", record.Name),
+		slog.String("type", record.Type),
+		slog.String("resolver", record.ResolverIP.String()),
+		slog.String("edgeLocation", record.EdgeLocation),
+	}
+}
+
+// StartServer sets the desired count of the server's service to one unless
+// it is already running. It reports whether the service was scaled up.
+func (h *LambdaHandler) StartServer(ctx context.Context, server *Server) (bool, error) {
+	logger := h.Logger.With(slog.String("service", server.Service))
+
+	// Describe ECS service
+	describeServicesOutput, err := h.DescribeService(ctx, server.Service)
+	if err != nil {
+		logger.Error("Failed to describe ECS service", slog.String("error", err.Error()))
+		return false, err
+	}
+
+	if len(describeServicesOutput.Services) == 0 {
+		logger.Error("No services found", slog.String("cluster", h.Config.Cluster))
+		return false, err
+	}
+
 	// Check desired count of the service
 	desiredCount := describeServicesOutput.Services[0].DesiredCount
-	h.Logger.Info("Current desired count", slog.Int("desiredCount", int(desiredCount)))
+	logger.Info("Current desired count", slog.Int("desiredCount", int(desiredCount)))
 
-	// Update desired count if it's 0
+	// Update desired count if it's 0. A previous session may have been moved
+	// to on-demand capacity after a Spot interruption, so every new session
+	// starts on the provider of the configured capacity mode.
 	if desiredCount == 0 {
-		err = h.UpdateDesiredCount(ctx, 1)
+		provider := server.CapacityMode.Provider()
+		current := capacity.CurrentProvider(describeServicesOutput.Services[0].CapacityProviderStrategy)
+		if current != provider {
+			logger.Info("Switching capacity provider", slog.String("from", current), slog.String("to", provider))
+			err = h.StartOnProvider(ctx, server.Service, provider)
+		} else {
+			err = h.UpdateDesiredCount(ctx, server.Service, 1)
+		}
 		if err != nil {
-			h.Logger.Error("Failed to update ECS service desired count", slog.String("error", err.Error()))
-			return err
+			logger.Error("Failed to update ECS service desired count", slog.String("error", err.Error()))
+			return false, err
 		}
-		h.Logger.Info("Updated desiredCount to 1")
-	} else {
-		h.Logger.Info("desiredCount already at 1")
+		logger.Info("Updated desiredCount to 1")
+		return true, nil
 	}
 
-	return nil
+	logger.Info("desiredCount already at 1")
+	return false, nil
 }
 
 func main() {
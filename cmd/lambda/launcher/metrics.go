@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Reasons a query log record does not start the server, in addition to the
+// resolver filter reasons.
+const (
+	rejectInvalidRecord = "invalid_record"
+	rejectRecordType    = "record_type"
+	rejectUnknownServer = "unknown_server"
+)
+
+// unknownService is the service of rejected records that cannot be routed
+// to a server.
+const unknownService = "unknown"
+
+const (
+	metricsNamespace     = "MinecraftServer/Launcher"
+	rejectedWakeupMetric = "RejectedWakeups"
+)
+
+// rejectWakeup logs a rejected query. The log line uses the CloudWatch
+// embedded metric format, so Lambda also counts it as the RejectedWakeups
+// metric by service and reason. server is nil if the record cannot be routed.
+func (h *LambdaHandler) rejectWakeup(server *Server, reason string, attrs ...any) {
+	service := unknownService
+	if server != nil {
+		service = server.Service
+	}
+	emf := map[string]any{
+		"Timestamp": time.Now().UnixMilli(),
+		"CloudWatchMetrics": []map[string]any{{
+			"Namespace":  metricsNamespace,
+			"Dimensions": [][]string{{"Service", "Reason"}},
+			"Metrics":    []map[string]string{{"Name": rejectedWakeupMetric, "Unit": "Count"}},
+		}},
+	}
+	attrs = append(attrs,
+		slog.Any("_aws", emf),
+		slog.String("Service", service),
+		slog.String("Reason", reason),
+		slog.Int(rejectedWakeupMetric, 1),
+	)
+	h.Logger.Info("Ignoring query", attrs...)
+}
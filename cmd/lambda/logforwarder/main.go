@@ -1,17 +1,15 @@
 package main
 
 import (
-	"bytes"
-	"compress/gzip"
+	"cmp"
 	"context"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
-	"math/rand"
 	"os"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -20,170 +18,295 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	awslambda "github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/wake"
 )
 
+// PutLogEvents limits, see
+// https://docs.aws.amazon.com/AmazonCloudWatchLogs/latest/APIReference/API_PutLogEvents.html.
+const (
+	maxBatchEvents = 10000
+	maxBatchBytes  = 1048576
+	// eventOverhead is added to the UTF-8 length of every message.
+	eventOverhead = 26
+	// maxBatchSpan is the longest time range a single batch may cover.
+	maxBatchSpan = 24 * time.Hour
+)
+
+// streamPrefix is prepended to the source stream name, e.g.
+// "forwarded/Z0123456789ABC/FRA56-P1".
+const streamPrefix = "forwarded/"
+
 type LogForwarder struct {
+	Mode         wake.Mode
 	LogGroupName string
 	LogsClient   *cloudwatchlogs.Client
 	Logger       *slog.Logger
-}
 
-// CloudWatch Log Event Structure.
-type CloudWatchLogEvent struct {
-	ID        string `json:"id"`
-	Timestamp int64  `json:"timestamp"`
-	Message   string `json:"message"`
-}
+	// ServerNames, TargetARN and one of the clients below are used by the
+	// eventbridge and invoke wake modes. Records are routed to the servers
+	// by name, e.g. "mc.example.com".
+	ServerNames  []string
+	TargetARN    string
+	EventsClient *eventbridge.Client
+	LambdaClient *awslambda.Client
 
-// Log Event Data Structure.
-type LogData struct {
-	MessageType string               `json:"messageType"`
-	LogEvents   []CloudWatchLogEvent `json:"logEvents"`
-	LogGroup    string               `json:"logGroup"`
-	LogStream   string               `json:"logStream"`
+	// streams caches the target streams known to exist, so warm invocations
+	// skip CreateLogStream.
+	mu      sync.Mutex
+	streams map[string]bool
 }
 
 func NewLogForwarder() *LogForwarder {
-	// Get the target log group name or ARN from environment variables
-	logGroupName := os.Getenv("TARGET_LOG_GROUP_NAME")
-	logGroupArn := os.Getenv("TARGET_LOG_GROUP_ARN")
-
-	if logGroupName == "" && logGroupArn == "" {
-		slog.Error("Missing environment variable: either TARGET_LOG_GROUP_NAME or TARGET_LOG_GROUP_ARN must be set")
+	mode, err := wake.ParseMode(getenvOrDefault("WAKE_MODE", string(wake.Logs)))
+	if err != nil {
+		slog.Error("Invalid wake mode", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
 
-	// If logGroupName is not directly provided, extract it from the ARN
-	if logGroupName == "" {
-		logGroupName = extractLogGroupName(logGroupArn)
+	// Get the target and its region from environment variables
+	target, err := resolveTarget(mode, os.Getenv)
+	if err != nil {
+		slog.Error("Invalid log forwarding target", slog.String("error", err.Error()))
+		os.Exit(1)
 	}
 
-	// Load AWS SDK configuration
-	awsCfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion("eu-central-1"))
+	// Load AWS SDK configuration for the target region
+	awsCfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(target.Region), config.WithRetryer(newRetryer))
 	if err != nil {
 		slog.Error("Failed to load AWS configuration", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
 
-	// Create CloudWatch Logs client
-	logsClient := cloudwatchlogs.NewFromConfig(awsCfg)
-
-	// Setup structured logging
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{}))
+	// Refuse to forward into another account than the ARN names, PutLogEvents
+	// would only fail on every invocation
+	if target.AccountID != "" {
+		identity, err := sts.NewFromConfig(awsCfg).GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+		if err != nil {
+			slog.Error("Failed to get caller identity", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		if account := aws.ToString(identity.Account); account != target.AccountID {
+			slog.Error("Target log group belongs to another account",
+				slog.String("targetAccount", target.AccountID),
+				slog.String("callerAccount", account),
+			)
+			os.Exit(1)
+		}
+	}
 
-	return &LogForwarder{
-		LogGroupName: logGroupName,
-		LogsClient:   logsClient,
-		Logger:       logger,
+	forwarder := &LogForwarder{
+		Mode:         mode,
+		LogGroupName: target.LogGroupName,
+		ServerNames:  splitList(os.Getenv("SERVERNAMES")),
+		TargetARN:    target.ARN,
+		streams:      make(map[string]bool),
+	}
+	if mode != wake.Logs && len(forwarder.ServerNames) == 0 {
+		slog.Error("SERVERNAMES is required in the wake mode", slog.String("mode", string(mode)))
+		os.Exit(1)
 	}
-}
 
-// Extract log group name from ARN.
-func extractLogGroupName(arn string) string {
-	parts := strings.Split(arn, ":")
-	if len(parts) < 6 {
-		return ""
+	// Create the client of the wake mode
+	switch mode {
+	case wake.EventBridge:
+		forwarder.EventsClient = eventbridge.NewFromConfig(awsCfg)
+	case wake.Invoke:
+		forwarder.LambdaClient = awslambda.NewFromConfig(awsCfg)
+	default:
+		forwarder.LogsClient = cloudwatchlogs.NewFromConfig(awsCfg)
 	}
-	// Extract the log group name part from the ARN
-	return strings.TrimPrefix(parts[5], "log-group:")
+
+	// Setup structured logging
+	forwarder.Logger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{}))
+	forwarder.Logger.Info("Forwarding log events",
+		slog.String("mode", string(mode)),
+		slog.String("logGroupName", target.LogGroupName),
+		slog.String("target", target.ARN),
+		slog.String("region", target.Region),
+		slog.Any("servers", forwarder.ServerNames),
+	)
+	return forwarder
 }
 
-// decompressGzip decompresses gzipped data.
-func decompressGzip(data []byte) ([]byte, error) {
-	gzipReader, err := gzip.NewReader(bytes.NewReader(data))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+// splitList splits a comma separated list, skipping empty elements.
+func splitList(s string) []string {
+	var list []string
+	for _, element := range strings.Split(s, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			list = append(list, element)
+		}
 	}
-	// nolint: errcheck
-	defer gzipReader.Close()
+	return list
+}
 
-	var decompressed bytes.Buffer
-	_, err = io.Copy(&decompressed, gzipReader)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decompress data: %w", err)
+func getenvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
 	}
-
-	return decompressed.Bytes(), nil
+	return defaultValue
 }
 
-// generateUniqueLogStreamName creates a unique name using timestamp and a random suffix.
-func generateUniqueLogStreamName() string {
-	timestamp := time.Now().UnixNano()
-	randomSuffix := rand.Intn(100000)
-	return fmt.Sprintf("forwarded-%d-%d", timestamp, randomSuffix)
+// targetStreamName returns the stable target stream of a source stream.
+// Stream names must not contain ':' or '*'.
+func targetStreamName(sourceStream string) string {
+	return streamPrefix + strings.NewReplacer(":", "_", "*", "_").Replace(sourceStream)
 }
 
-// HandleRequest processes the incoming CloudWatch Logs and forwards them.
+// HandleRequest hands the events of a CloudWatch Logs subscription payload to
+// the launcher as configured by the wake mode.
 func (f *LogForwarder) HandleRequest(ctx context.Context, event events.CloudwatchLogsEvent) error {
-	// Decode the CloudWatch Logs data
-	decodedData, err := base64.StdEncoding.DecodeString(event.AWSLogs.Data)
+	logData, err := event.AWSLogs.Parse()
 	if err != nil {
 		f.Logger.Error("Failed to decode log data", slog.String("error", err.Error()))
 		return err
 	}
+	if len(logData.LogEvents) == 0 {
+		return nil
+	}
 
-	// Decompress the gzipped log data
-	decompressedData, err := decompressGzip(decodedData)
-	if err != nil {
-		f.Logger.Error("Failed to decompress log data", slog.String("error", err.Error()))
-		return err
+	switch f.Mode {
+	case wake.EventBridge:
+		return f.putWakeEvents(ctx, logData)
+	case wake.Invoke:
+		return f.invokeLauncher(ctx, logData)
+	default:
+		return f.forwardLogEvents(ctx, logData)
 	}
+}
 
-	// Unmarshal the log event data
-	var logData LogData
-	err = json.Unmarshal(decompressedData, &logData)
-	if err != nil {
-		f.Logger.Error("Failed to unmarshal log data", slog.String("error", err.Error()))
+// forwardLogEvents forwards all events to the target stream of their source
+// stream, in as few PutLogEvents calls as the API limits allow.
+func (f *LogForwarder) forwardLogEvents(ctx context.Context, logData events.CloudwatchLogsData) error {
+	stream := targetStreamName(logData.LogStream)
+	if err := f.ensureLogStream(ctx, stream); err != nil {
 		return err
 	}
 
-	// Prepare log events to send to the target log group
-	for _, logEvent := range logData.LogEvents {
-		err = f.forwardLogEvent(ctx, logEvent)
-		if err != nil {
-			f.Logger.Error("Failed to forward log event", slog.String("eventID", logEvent.ID), slog.String("logGroupName", f.LogGroupName), slog.String("error", err.Error()))
+	batches := batchLogEvents(logData.LogEvents)
+	var errs []error
+	failed := 0
+	for _, batch := range batches {
+		if err := f.putLogEvents(ctx, stream, batch); err != nil {
+			errs = append(errs, err)
+			failed += len(batch)
 		}
 	}
+	if len(errs) > 0 {
+		return f.deliveryResult(logData.LogGroup, stream, errs, failed, len(logData.LogEvents))
+	}
 
+	f.Logger.Info("Forwarded log events",
+		slog.String("logGroupName", f.LogGroupName),
+		slog.String("logStreamName", stream),
+		slog.Int("events", len(logData.LogEvents)),
+		slog.Int("batches", len(batches)),
+	)
 	return nil
 }
 
-// forwardLogEvent sends a single log event to the target log group.
-func (f *LogForwarder) forwardLogEvent(ctx context.Context, event CloudWatchLogEvent) error {
-	// Create a unique log stream name to avoid conflicts
-	logStreamName := generateUniqueLogStreamName()
+// deliveryResult turns the failure to deliver failed of total events of the
+// source log group to target into the result of the invocation. If nothing
+// was delivered, the error is returned, so Lambda retries the invocation and
+// finally sends it to the failure destination. Partial failures are only
+// reported, as retrying would deliver the other events again.
+func (f *LogForwarder) deliveryResult(source, target string, errs []error, failed, total int) error {
+	err := fmt.Errorf("failed to deliver %d of %d log events to %s: %w", failed, total, target, errors.Join(errs...))
+	if failed < total {
+		f.reportUndelivered(source, failed, err)
+		return nil
+	}
+	f.Logger.Error("Failed to deliver log events", slog.String("target", target), slog.String("error", err.Error()))
+	return err
+}
+
+// batchLogEvents sorts events chronologically, as PutLogEvents requires, and
+// splits them into batches within the count, size and time span limits.
+func batchLogEvents(logEvents []events.CloudwatchLogsLogEvent) [][]types.InputLogEvent {
+	sorted := slices.Clone(logEvents)
+	slices.SortStableFunc(sorted, func(a, b events.CloudwatchLogsLogEvent) int {
+		return cmp.Compare(a.Timestamp, b.Timestamp)
+	})
+
+	var batches [][]types.InputLogEvent
+	var batch []types.InputLogEvent
+	size := 0
+	for _, event := range sorted {
+		eventSize := len(event.Message) + eventOverhead
+		if len(batch) > 0 && (len(batch) == maxBatchEvents ||
+			size+eventSize > maxBatchBytes ||
+			time.Duration(event.Timestamp-*batch[0].Timestamp)*time.Millisecond >= maxBatchSpan) {
+			batches = append(batches, batch)
+			batch, size = nil, 0
+		}
+		batch = append(batch, types.InputLogEvent{
+			Message:   aws.String(event.Message),
+			Timestamp: aws.Int64(event.Timestamp),
+		})
+		size += eventSize
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// ensureLogStream creates stream unless it is known to exist.
+func (f *LogForwarder) ensureLogStream(ctx context.Context, stream string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	// Attempt to create the log stream in the target log group
+	if f.streams[stream] {
+		return nil
+	}
 	_, err := f.LogsClient.CreateLogStream(ctx, &cloudwatchlogs.CreateLogStreamInput{
 		LogGroupName:  aws.String(f.LogGroupName),
-		LogStreamName: aws.String(logStreamName),
+		LogStreamName: aws.String(stream),
 	})
-	if err != nil {
-		if !strings.Contains(err.Error(), "ResourceAlreadyExistsException") {
-			f.Logger.Error("Failed to create log stream", slog.String("logStreamName", logStreamName), slog.String("logGroupName", f.LogGroupName), slog.String("error", err.Error()))
+	var exists *types.ResourceAlreadyExistsException
+	if err != nil && !errors.As(err, &exists) {
+		f.Logger.Error("Failed to create log stream", slog.String("logStreamName", stream), slog.String("logGroupName", f.LogGroupName), slog.String("error", err.Error()))
+		return fmt.Errorf("failed to create log stream %s: %w", stream, err)
+	}
+	f.streams[stream] = true
+	return nil
+}
+
+// putLogEvents sends a single batch. If the cached stream has been deleted
+// in the meantime, it is created again and the batch retried once. Events
+// CloudWatch rejects for their timestamp are logged, retrying cannot help.
+func (f *LogForwarder) putLogEvents(ctx context.Context, stream string, batch []types.InputLogEvent) error {
+	input := &cloudwatchlogs.PutLogEventsInput{
+		LogEvents:     batch,
+		LogGroupName:  aws.String(f.LogGroupName),
+		LogStreamName: aws.String(stream),
+	}
+	resp, err := f.LogsClient.PutLogEvents(ctx, input)
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		f.mu.Lock()
+		delete(f.streams, stream)
+		f.mu.Unlock()
+		if err := f.ensureLogStream(ctx, stream); err != nil {
 			return err
 		}
-		// If the log stream already exists, proceed
-		f.Logger.Info("Log stream already exists, proceeding to put log events", slog.String("logStreamName", logStreamName))
-	}
-
-	// Send the log event to the created log stream
-	_, err = f.LogsClient.PutLogEvents(ctx, &cloudwatchlogs.PutLogEventsInput{
-		LogEvents: []types.InputLogEvent{
-			{
-				Message:   aws.String(event.Message),
-				Timestamp: aws.Int64(event.Timestamp),
-			},
-		},
-		LogGroupName:  aws.String(f.LogGroupName),
-		LogStreamName: aws.String(logStreamName),
-	})
+		resp, err = f.LogsClient.PutLogEvents(ctx, input)
+	}
 	if err != nil {
-		f.Logger.Error("Failed to put log event", slog.String("logStreamName", logStreamName), slog.String("logGroupName", f.LogGroupName), slog.String("eventID", event.ID), slog.String("error", err.Error()))
-		return err
+		return fmt.Errorf("failed to put %d log events: %w", len(batch), err)
 	}
 
-	f.Logger.Info("Successfully forwarded log event", slog.String("logStreamName", logStreamName), slog.String("logGroupName", f.LogGroupName), slog.String("eventID", event.ID))
+	if rejected := resp.RejectedLogEventsInfo; rejected != nil {
+		f.Logger.Error("CloudWatch rejected log events",
+			slog.String("logStreamName", stream),
+			slog.Int("batchSize", len(batch)),
+			slog.Any("tooOldLogEventEndIndex", rejected.TooOldLogEventEndIndex),
+			slog.Any("tooNewLogEventStartIndex", rejected.TooNewLogEventStartIndex),
+			slog.Any("expiredLogEventEndIndex", rejected.ExpiredLogEventEndIndex),
+		)
+	}
 	return nil
 }
 
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+const (
+	metricsNamespace        = "MinecraftServer/LogForwarder"
+	undeliveredEventsMetric = "UndeliveredEvents"
+)
+
+// reportUndelivered logs that count events could not be delivered although
+// others were, so the invocation succeeds and Lambda does not retry it. The
+// log line uses the CloudWatch embedded metric format, so Lambda also counts
+// the events as the UndeliveredEvents metric by source log group.
+func (f *LogForwarder) reportUndelivered(logGroup string, count int, err error) {
+	emf := map[string]any{
+		"Timestamp": time.Now().UnixMilli(),
+		"CloudWatchMetrics": []map[string]any{{
+			"Namespace":  metricsNamespace,
+			"Dimensions": [][]string{{"LogGroup"}},
+			"Metrics":    []map[string]string{{"Name": undeliveredEventsMetric, "Unit": "Count"}},
+		}},
+	}
+	f.Logger.Error("Failed to deliver some log events",
+		slog.String("error", err.Error()),
+		slog.Any("_aws", emf),
+		slog.String("LogGroup", logGroup),
+		slog.Int(undeliveredEventsMetric, count),
+	)
+}
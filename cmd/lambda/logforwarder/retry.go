@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+// Retry limits of the forwarder. The Lambda timeout in NewQueryLogStack
+// leaves room for all attempts.
+const (
+	maxAttempts = 5
+	baseBackoff = 100 * time.Millisecond
+	maxBackoff  = 2 * time.Second
+)
+
+// newRetryer returns the retryer of the AWS clients. It retries throttling
+// and transient errors with jittered exponential backoff. The client side
+// retry quota is disabled, as it would fail calls during the bursts it is
+// meant to ride out.
+func newRetryer() aws.Retryer {
+	return retry.NewStandard(func(o *retry.StandardOptions) {
+		o.MaxAttempts = maxAttempts
+		o.MaxBackoff = maxBackoff
+		o.RateLimiter = ratelimit.None
+	})
+}
+
+// backoff returns the delay before retrying after attempt, with full jitter.
+func backoff(attempt int) time.Duration {
+	return rand.N(min(maxBackoff, baseBackoff<<attempt))
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/wake"
+)
+
+// target is where events are forwarded to: a log group, an event bus or the
+// launcher function, depending on the wake mode.
+type target struct {
+	// LogGroupName is only set in the logs wake mode.
+	LogGroupName string
+	ARN          string
+	Region       string
+	// AccountID is empty if the target was configured without an ARN.
+	AccountID string
+}
+
+// resolveTarget builds the target of mode from the environment. TARGET_REGION
+// is optional if the target is configured by ARN, but must match it if set.
+func resolveTarget(mode wake.Mode, getenv func(string) string) (target, error) {
+	var t target
+	var err error
+	switch mode {
+	case wake.EventBridge:
+		t, err = parseTargetARN("TARGET_EVENT_BUS_ARN", getenv("TARGET_EVENT_BUS_ARN"), "events", "event-bus/")
+	case wake.Invoke:
+		t, err = parseTargetARN("TARGET_FUNCTION_ARN", getenv("TARGET_FUNCTION_ARN"), "lambda", "function:")
+	default:
+		return resolveLogGroupTarget(getenv("TARGET_LOG_GROUP_NAME"), getenv("TARGET_LOG_GROUP_ARN"), getenv("TARGET_REGION"))
+	}
+	if err != nil {
+		return target{}, err
+	}
+	if region := getenv("TARGET_REGION"); region != "" && region != t.Region {
+		return target{}, fmt.Errorf("TARGET_REGION %q does not match region %q of %s", region, t.Region, t.ARN)
+	}
+	return t, nil
+}
+
+// parseTargetARN parses the ARN in the environment variable env, which must
+// name a resource of service whose resource part starts with resourcePrefix.
+func parseTargetARN(env, s, service, resourcePrefix string) (target, error) {
+	if s == "" {
+		return target{}, fmt.Errorf("%s must be set", env)
+	}
+	a, err := arn.Parse(s)
+	if err != nil {
+		return target{}, fmt.Errorf("invalid %s %q: %w", env, s, err)
+	}
+	if a.Service != service || !strings.HasPrefix(a.Resource, resourcePrefix) || len(a.Resource) == len(resourcePrefix) {
+		return target{}, fmt.Errorf("invalid %s %q: want a %s ARN with a %s resource", env, s, service, strings.TrimRight(resourcePrefix, ":/"))
+	}
+	if a.Region == "" || a.AccountID == "" {
+		return target{}, fmt.Errorf("invalid %s %q: missing region or account", env, s)
+	}
+	return target{ARN: s, Region: a.Region, AccountID: a.AccountID}, nil
+}
+
+// resolveLogGroupTarget builds the log group target from TARGET_LOG_GROUP_NAME,
+// TARGET_LOG_GROUP_ARN and TARGET_REGION. The ARN provides all three values,
+// a name or region set alongside it must agree with it. Without an ARN, both
+// name and region are required, so the forwarder never falls back to a
+// region nobody configured.
+func resolveLogGroupTarget(name, groupARN, region string) (target, error) {
+	if groupARN == "" {
+		if name == "" || region == "" {
+			return target{}, errors.New("either TARGET_LOG_GROUP_ARN or both TARGET_LOG_GROUP_NAME and TARGET_REGION must be set")
+		}
+		return target{LogGroupName: name, Region: region}, nil
+	}
+
+	t, err := parseLogGroupARN(groupARN)
+	if err != nil {
+		return target{}, err
+	}
+	if name != "" && name != t.LogGroupName {
+		return target{}, fmt.Errorf("TARGET_LOG_GROUP_NAME %q does not match log group %q of TARGET_LOG_GROUP_ARN", name, t.LogGroupName)
+	}
+	if region != "" && region != t.Region {
+		return target{}, fmt.Errorf("TARGET_REGION %q does not match region %q of TARGET_LOG_GROUP_ARN", region, t.Region)
+	}
+	return t, nil
+}
+
+// parseLogGroupARN parses a CloudWatch Logs log group ARN, with or without
+// the trailing ":*" IAM policies use, e.g.
+// "arn:aws:logs:eu-central-1:123456789012:log-group:/aws/route53/mc.example.com:*".
+func parseLogGroupARN(s string) (target, error) {
+	a, err := arn.Parse(s)
+	if err != nil {
+		return target{}, fmt.Errorf("invalid log group ARN %q: %w", s, err)
+	}
+	if a.Service != "logs" {
+		return target{}, fmt.Errorf("invalid log group ARN %q: service is %q, want logs", s, a.Service)
+	}
+	if a.Region == "" || a.AccountID == "" {
+		return target{}, fmt.Errorf("invalid log group ARN %q: missing region or account", s)
+	}
+	name, ok := strings.CutPrefix(a.Resource, "log-group:")
+	if !ok {
+		return target{}, fmt.Errorf("invalid log group ARN %q: resource is not a log group", s)
+	}
+	name = strings.TrimSuffix(name, ":*")
+	if name == "" || strings.Contains(name, ":") {
+		return target{}, fmt.Errorf("invalid log group ARN %q: invalid log group name", s)
+	}
+	return target{LogGroupName: name, ARN: s, Region: a.Region, AccountID: a.AccountID}, nil
+}
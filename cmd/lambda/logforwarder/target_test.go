@@ -0,0 +1,197 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/wake"
+)
+
+const testLogGroupARN = "arn:aws:logs:eu-central-1:123456789012:log-group:/aws/route53/mc.example.com"
+
+func TestParseLogGroupARN(t *testing.T) {
+	tests := []struct {
+		name    string
+		arn     string
+		want    target
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			arn:  testLogGroupARN,
+			want: target{LogGroupName: "/aws/route53/mc.example.com", ARN: testLogGroupARN, Region: "eu-central-1", AccountID: "123456789012"},
+		},
+		{
+			name: "trailing wildcard",
+			arn:  testLogGroupARN + ":*",
+			want: target{LogGroupName: "/aws/route53/mc.example.com", ARN: testLogGroupARN + ":*", Region: "eu-central-1", AccountID: "123456789012"},
+		},
+		{
+			name: "china partition",
+			arn:  "arn:aws-cn:logs:cn-north-1:123456789012:log-group:queries",
+			want: target{LogGroupName: "queries", ARN: "arn:aws-cn:logs:cn-north-1:123456789012:log-group:queries", Region: "cn-north-1", AccountID: "123456789012"},
+		},
+		{
+			name: "govcloud partition",
+			arn:  "arn:aws-us-gov:logs:us-gov-west-1:123456789012:log-group:queries:*",
+			want: target{LogGroupName: "queries", ARN: "arn:aws-us-gov:logs:us-gov-west-1:123456789012:log-group:queries:*", Region: "us-gov-west-1", AccountID: "123456789012"},
+		},
+		{name: "not an ARN", arn: "/aws/route53/mc.example.com", wantErr: true},
+		{name: "empty", arn: "", wantErr: true},
+		{name: "not logs", arn: "arn:aws:lambda:eu-central-1:123456789012:function:launcher", wantErr: true},
+		{name: "wrong resource type", arn: "arn:aws:logs:eu-central-1:123456789012:destination:queries", wantErr: true},
+		{name: "missing log group name", arn: "arn:aws:logs:eu-central-1:123456789012:log-group:", wantErr: true},
+		{name: "only wildcard", arn: "arn:aws:logs:eu-central-1:123456789012:log-group::*", wantErr: true},
+		{name: "log stream suffix", arn: testLogGroupARN + ":log-stream:abc", wantErr: true},
+		{name: "missing region", arn: "arn:aws:logs::123456789012:log-group:queries", wantErr: true},
+		{name: "missing account", arn: "arn:aws:logs:eu-central-1::log-group:queries", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLogGroupARN(tt.arn)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseLogGroupARN(%q) = %+v, want an error", tt.arn, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseLogGroupARN(%q): %v", tt.arn, err)
+			}
+			if got != tt.want {
+				t.Fatalf("parseLogGroupARN(%q) = %+v, want %+v", tt.arn, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	const (
+		busARN      = "arn:aws:events:us-east-1:123456789012:event-bus/minecraft-wake"
+		functionARN = "arn:aws:lambda:us-east-1:123456789012:function:launcher"
+	)
+	tests := []struct {
+		name    string
+		mode    wake.Mode
+		env     map[string]string
+		want    target
+		wantErr bool
+	}{
+		{
+			name: "log group by ARN",
+			mode: wake.Logs,
+			env:  map[string]string{"TARGET_LOG_GROUP_ARN": testLogGroupARN},
+			want: target{LogGroupName: "/aws/route53/mc.example.com", ARN: testLogGroupARN, Region: "eu-central-1", AccountID: "123456789012"},
+		},
+		{
+			name: "log group by ARN with matching name and region",
+			mode: wake.Logs,
+			env: map[string]string{
+				"TARGET_LOG_GROUP_ARN":  testLogGroupARN + ":*",
+				"TARGET_LOG_GROUP_NAME": "/aws/route53/mc.example.com",
+				"TARGET_REGION":         "eu-central-1",
+			},
+			want: target{LogGroupName: "/aws/route53/mc.example.com", ARN: testLogGroupARN + ":*", Region: "eu-central-1", AccountID: "123456789012"},
+		},
+		{
+			name: "log group by name and region",
+			mode: wake.Logs,
+			env:  map[string]string{"TARGET_LOG_GROUP_NAME": "queries", "TARGET_REGION": "us-east-1"},
+			want: target{LogGroupName: "queries", Region: "us-east-1"},
+		},
+		{
+			name:    "log group name without region",
+			mode:    wake.Logs,
+			env:     map[string]string{"TARGET_LOG_GROUP_NAME": "queries"},
+			wantErr: true,
+		},
+		{
+			name:    "nothing configured",
+			mode:    wake.Logs,
+			env:     map[string]string{},
+			wantErr: true,
+		},
+		{
+			name: "log group name conflicts with ARN",
+			mode: wake.Logs,
+			env: map[string]string{
+				"TARGET_LOG_GROUP_ARN":  testLogGroupARN,
+				"TARGET_LOG_GROUP_NAME": "/aws/route53/other.example.com",
+			},
+			wantErr: true,
+		},
+		{
+			name: "region conflicts with log group ARN",
+			mode: wake.Logs,
+			env: map[string]string{
+				"TARGET_LOG_GROUP_ARN": testLogGroupARN,
+				"TARGET_REGION":        "us-east-1",
+			},
+			wantErr: true,
+		},
+		{
+			name:    "invalid log group ARN",
+			mode:    wake.Logs,
+			env:     map[string]string{"TARGET_LOG_GROUP_ARN": busARN},
+			wantErr: true,
+		},
+		{
+			name: "event bus",
+			mode: wake.EventBridge,
+			env:  map[string]string{"TARGET_EVENT_BUS_ARN": busARN, "TARGET_REGION": "us-east-1"},
+			want: target{ARN: busARN, Region: "us-east-1", AccountID: "123456789012"},
+		},
+		{
+			name:    "region conflicts with event bus ARN",
+			mode:    wake.EventBridge,
+			env:     map[string]string{"TARGET_EVENT_BUS_ARN": busARN, "TARGET_REGION": "eu-central-1"},
+			wantErr: true,
+		},
+		{
+			name:    "event bus ARN of another service",
+			mode:    wake.EventBridge,
+			env:     map[string]string{"TARGET_EVENT_BUS_ARN": functionARN},
+			wantErr: true,
+		},
+		{
+			name:    "event bus ARN missing",
+			mode:    wake.EventBridge,
+			env:     map[string]string{"TARGET_FUNCTION_ARN": functionARN},
+			wantErr: true,
+		},
+		{
+			name: "function",
+			mode: wake.Invoke,
+			env:  map[string]string{"TARGET_FUNCTION_ARN": functionARN},
+			want: target{ARN: functionARN, Region: "us-east-1", AccountID: "123456789012"},
+		},
+		{
+			name:    "function ARN without function name",
+			mode:    wake.Invoke,
+			env:     map[string]string{"TARGET_FUNCTION_ARN": "arn:aws:lambda:us-east-1:123456789012:function:"},
+			wantErr: true,
+		},
+		{
+			name:    "function ARN missing account",
+			mode:    wake.Invoke,
+			env:     map[string]string{"TARGET_FUNCTION_ARN": "arn:aws:lambda:us-east-1::function:launcher"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveTarget(tt.mode, func(key string) string { return tt.env[key] })
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("resolveTarget() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveTarget(): %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("resolveTarget() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
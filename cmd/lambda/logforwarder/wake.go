@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	eventbridgetypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	awslambda "github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/querylog"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/wake"
+)
+
+const (
+	// maxPutEventsEntries is the number of entries PutEvents accepts per call.
+	maxPutEventsEntries = 10
+	// maxPutEventsSize is the total size of the entries PutEvents accepts per
+	// call, as computed by entrySize.
+	maxPutEventsSize = 256 * 1024
+	// entryTimeSize is what EventBridge counts for an entry's Time.
+	entryTimeSize = 14
+)
+
+// retryableEntryErrors are the PutEvents entry error codes worth retrying.
+// The SDK only retries failed calls, not failed entries of a call.
+var retryableEntryErrors = map[string]bool{
+	"ThrottlingException": true,
+	"InternalFailure":     true,
+	"InternalException":   true,
+}
+
+// wakeRequests routes the records to the servers they query and wraps them
+// into wake requests. Records of unknown servers are dropped. It also returns
+// the number of records in the requests.
+func (f *LogForwarder) wakeRequests(logData events.CloudwatchLogsData) ([]wake.Request, int, error) {
+	byServer := make(map[string][]events.CloudwatchLogsLogEvent)
+	dropped := 0
+	for _, record := range logData.LogEvents {
+		// Records that cannot be parsed are only routed to a single server,
+		// whose launcher counts them as invalid
+		name := ""
+		if parsed, err := querylog.Parse(record.Message); err == nil {
+			name = parsed.Name
+		}
+		server, ok := wake.MatchServer(name, f.ServerNames)
+		if !ok {
+			dropped++
+			continue
+		}
+		byServer[server] = append(byServer[server], record)
+	}
+	if dropped > 0 {
+		f.Logger.Warn("Dropping query log records of unknown servers",
+			slog.Int("records", dropped),
+			slog.Any("servers", f.ServerNames),
+		)
+	}
+
+	var requests []wake.Request
+	total := 0
+	for _, server := range f.ServerNames {
+		records := byServer[server]
+		if len(records) == 0 {
+			continue
+		}
+		data := logData
+		data.LogEvents = records
+		serverRequests, err := wake.NewRequests(server, data)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to encode wake request: %w", err)
+		}
+		requests = append(requests, serverRequests...)
+		total += len(records)
+	}
+	return requests, total, nil
+}
+
+// putWakeEvents sends the records as ServerWakeRequested events to the target
+// event bus.
+func (f *LogForwarder) putWakeEvents(ctx context.Context, logData events.CloudwatchLogsData) error {
+	requests, total, err := f.wakeRequests(logData)
+	if err != nil {
+		return err
+	}
+	entries := make([]eventbridgetypes.PutEventsRequestEntry, 0, len(requests))
+	for _, request := range requests {
+		detail, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("failed to encode wake request: %w", err)
+		}
+		entries = append(entries, eventbridgetypes.PutEventsRequestEntry{
+			EventBusName: aws.String(f.TargetARN),
+			Source:       aws.String(wake.Source),
+			DetailType:   aws.String(wake.DetailType),
+			Detail:       aws.String(string(detail)),
+		})
+	}
+
+	var errs []error
+	failed := 0
+	for start := 0; start < len(entries); {
+		end := nextBatch(entries, start)
+		undelivered, err := f.putEvents(ctx, entries[start:end])
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, i := range undelivered {
+			failed += len(requests[start+i].Records)
+		}
+		start = end
+	}
+	if len(errs) > 0 {
+		return f.deliveryResult(logData.LogGroup, f.TargetARN, errs, failed, total)
+	}
+	f.logWakeRequests(len(requests), total)
+	return nil
+}
+
+// nextBatch returns the end of the batch of entries beginning at start that
+// fits into a single PutEvents call, both by count and by total size. An entry
+// too large for any call is sent on its own, so EventBridge only rejects that
+// entry rather than the whole call.
+func nextBatch(entries []eventbridgetypes.PutEventsRequestEntry, start int) int {
+	end, size := start, 0
+	for end < len(entries) && end-start < maxPutEventsEntries {
+		size += entrySize(entries[end])
+		if end > start && size > maxPutEventsSize {
+			break
+		}
+		end++
+	}
+	return end
+}
+
+// entrySize returns the size EventBridge counts for entry towards the
+// PutEvents limit: its time, source, detail type, detail and resources.
+func entrySize(entry eventbridgetypes.PutEventsRequestEntry) int {
+	size := len(aws.ToString(entry.Source)) + len(aws.ToString(entry.DetailType)) + len(aws.ToString(entry.Detail))
+	if entry.Time != nil {
+		size += entryTimeSize
+	}
+	for _, resource := range entry.Resources {
+		size += len(resource)
+	}
+	return size
+}
+
+// putEvents sends entries in one call and retries the entries EventBridge
+// rejected for throttling or internal errors. It returns the indexes of the
+// entries that were not delivered.
+func (f *LogForwarder) putEvents(ctx context.Context, entries []eventbridgetypes.PutEventsRequestEntry) ([]int, error) {
+	pending := make([]int, len(entries))
+	for i := range pending {
+		pending[i] = i
+	}
+	var undelivered []int
+	var errs []error
+	for attempt := 1; ; attempt++ {
+		batch := make([]eventbridgetypes.PutEventsRequestEntry, 0, len(pending))
+		for _, i := range pending {
+			batch = append(batch, entries[i])
+		}
+		resp, err := f.EventsClient.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: batch})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to put %d wake events: %w", len(batch), err))
+			return append(undelivered, pending...), errors.Join(errs...)
+		}
+
+		var retry []int
+		for j, entry := range resp.Entries {
+			code := aws.ToString(entry.ErrorCode)
+			switch {
+			case code == "":
+			case retryableEntryErrors[code] && attempt < maxAttempts:
+				retry = append(retry, pending[j])
+			default:
+				errs = append(errs, fmt.Errorf("wake event rejected: %s: %s", code, aws.ToString(entry.ErrorMessage)))
+				undelivered = append(undelivered, pending[j])
+			}
+		}
+		if len(retry) == 0 {
+			return undelivered, errors.Join(errs...)
+		}
+		f.Logger.Warn("Retrying rejected wake events", slog.Int("events", len(retry)), slog.Int("attempt", attempt))
+		if err := sleepContext(ctx, backoff(attempt)); err != nil {
+			errs = append(errs, err)
+			return append(undelivered, retry...), errors.Join(errs...)
+		}
+		pending = retry
+	}
+}
+
+// invokeLauncher invokes the launcher asynchronously with the records.
+func (f *LogForwarder) invokeLauncher(ctx context.Context, logData events.CloudwatchLogsData) error {
+	requests, total, err := f.wakeRequests(logData)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	failed := 0
+	for _, request := range requests {
+		payload, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("failed to encode wake request: %w", err)
+		}
+		_, err = f.LambdaClient.Invoke(ctx, &awslambda.InvokeInput{
+			FunctionName:   aws.String(f.TargetARN),
+			InvocationType: lambdatypes.InvocationTypeEvent,
+			Payload:        payload,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to invoke launcher: %w", err))
+			failed += len(request.Records)
+		}
+	}
+	if len(errs) > 0 {
+		return f.deliveryResult(logData.LogGroup, f.TargetARN, errs, failed, total)
+	}
+	f.logWakeRequests(len(requests), total)
+	return nil
+}
+
+// logWakeRequests logs the successful delivery of wake requests.
+func (f *LogForwarder) logWakeRequests(requests, records int) {
+	f.Logger.Info("Delivered wake requests",
+		slog.String("mode", string(f.Mode)),
+		slog.String("target", f.TargetARN),
+		slog.Int("events", records),
+		slog.Int("requests", requests),
+	)
+}
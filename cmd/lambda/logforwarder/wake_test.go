@@ -0,0 +1,76 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	eventbridgetypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+func TestNextBatch(t *testing.T) {
+	// entries returns n entries whose detail is size bytes.
+	entries := func(n, size int) []eventbridgetypes.PutEventsRequestEntry {
+		entry := eventbridgetypes.PutEventsRequestEntry{Detail: aws.String(strings.Repeat("x", size))}
+		var out []eventbridgetypes.PutEventsRequestEntry
+		for range n {
+			out = append(out, entry)
+		}
+		return out
+	}
+	concat := func(parts ...[]eventbridgetypes.PutEventsRequestEntry) []eventbridgetypes.PutEventsRequestEntry {
+		var out []eventbridgetypes.PutEventsRequestEntry
+		for _, part := range parts {
+			out = append(out, part...)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		entries []eventbridgetypes.PutEventsRequestEntry
+		want    []int
+	}{
+		{name: "none", entries: nil, want: nil},
+		{name: "small entries by count", entries: entries(23, 100), want: []int{10, 10, 3}},
+		{name: "large entries by size", entries: entries(5, 240*1024), want: []int{1, 1, 1, 1, 1}},
+		{name: "entries filling the limit exactly", entries: entries(4, 64*1024), want: []int{4}},
+		{name: "entries just above the limit", entries: entries(4, 64*1024+1), want: []int{3, 1}},
+		{name: "oversized entry alone", entries: concat(entries(1, 100), entries(1, 300*1024), entries(2, 100)), want: []int{1, 1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for start := 0; start < len(tt.entries); {
+				end := nextBatch(tt.entries, start)
+				size := 0
+				for _, entry := range tt.entries[start:end] {
+					size += entrySize(entry)
+				}
+				if end-start > 1 && size > maxPutEventsSize {
+					t.Errorf("batch of %d entries is %d bytes, over the %d byte limit", end-start, size, maxPutEventsSize)
+				}
+				got = append(got, end-start)
+				start = end
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("batch sizes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEntrySize(t *testing.T) {
+	entry := eventbridgetypes.PutEventsRequestEntry{
+		EventBusName: aws.String("arn:aws:events:us-east-1:123456789012:event-bus/wake"),
+		Source:       aws.String("minecraft"),
+		DetailType:   aws.String("Wake"),
+		Detail:       aws.String(`{"a":1}`),
+		Resources:    []string{"arn:1", "arn:22"},
+	}
+	// The bus name does not count towards the limit.
+	if got, want := entrySize(entry), len("minecraft")+len("Wake")+len(`{"a":1}`)+len("arn:1")+len("arn:22"); got != want {
+		t.Fatalf("entrySize() = %d, want %d", got, want)
+	}
+}
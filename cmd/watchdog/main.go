@@ -1,55 +1,45 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"crypto/rand"
-	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/alexflint/go-arg"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	"github.com/aws/aws-sdk-go-v2/service/route53"
-	"github.com/aws/aws-sdk-go-v2/service/route53/types"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
-	psnet "github.com/shirou/gopsutil/net"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/notify"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/resolvers"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/sessions"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/watchdog"
 )
 
 const (
-	javaPort         = 25565
-	rconPort         = 25575
-	bedrockPort      = 19132
-	bedrockIP        = "127.0.0.1:19132"
-	taskMetaEndpoint = "ECS_CONTAINER_METADATA_URI_V4"
-	bedrockPingWait  = 1 * time.Second
-	checkInterval    = 1 * time.Minute
-	rconWaitInterval = 1 * time.Second
-	maxStartupWait   = 10 * time.Minute // 600 seconds
+	localhost         = "127.0.0.1"
+	taskMetaEndpoint  = "ECS_CONTAINER_METADATA_URI_V4"
+	statusReadTimeout = 5 * time.Second
+	healthCheckWait   = 3 * time.Second
 )
 
-type Config struct {
-	Cluster     string `arg:"env:CLUSTER,required" help:"ECS cluster name"`
-	Service     string `arg:"env:SERVICE,required" help:"ECS service name"`
-	ServerName  string `arg:"env:SERVERNAME,required" help:"Full A record in Route53"`
-	DNSZone     string `arg:"env:DNSZONE,required" help:"Route53 Hosted Zone ID"`
-	SNSTopic    string `arg:"env:SNSTOPIC" help:"SNS topic for notifications"`
-	StartupMin  int    `arg:"env:STARTUPMIN" default:"10" help:"Startup wait time in minutes"`
-	ShutdownMin int    `arg:"env:SHUTDOWNMIN" default:"20" help:"Shutdown wait time in minutes"`
-}
-
 func main() {
-	var cfg Config
+	cfg := watchdog.Config{ShutdownWarnings: watchdog.DefaultShutdownWarnings}
 	arg.MustParse(&cfg)
+	if cfg.HealthCheck {
+		os.Exit(runHealthCheck(cfg.HTTPPort))
+	}
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{}))
 
 	awsCfg, err := config.LoadDefaultConfig(context.TODO())
@@ -57,297 +47,124 @@ func main() {
 		exitWithError("Failed to load AWS configuration", err, logger)
 	}
 
-	ecsClient := ecs.NewFromConfig(awsCfg)
-	ec2Client := ec2.NewFromConfig(awsCfg)
-	route53Client := route53.NewFromConfig(awsCfg)
-	snsClient := sns.NewFromConfig(awsCfg)
-
-	taskID := fetchTaskID(logger)
-	publicIP := resolvePublicIP(ecsClient, ec2Client, &cfg, taskID, logger)
-	updateDNSRecord(route53Client, &cfg, publicIP, logger)
-
-	edition := determineEdition(&cfg, logger)
-	sendStartupNotification(snsClient, &cfg, edition, publicIP, logger)
-
-	if waitForInitialClientConnection(&cfg, edition, logger) {
-		monitorClientConnections(ecsClient, snsClient, &cfg, edition, logger)
-	} else {
-		logger.Info(fmt.Sprintf("%d minutes exceeded without a connection, initiating shutdown.", cfg.StartupMin))
-		shutdownService(ecsClient, snsClient, &cfg, logger)
-		exitWithError("No initial client connection established, service shut down.", nil, logger)
-	}
-}
-
-func fetchTaskID(logger *slog.Logger) string {
-	taskARN := os.Getenv(taskMetaEndpoint) + "/task"
-	resp, err := http.Get(taskARN)
+	sessionStore, err := newSessionStore(cfg, awsCfg)
 	if err != nil {
-		exitWithError("Failed to get task metadata", err, logger)
-	}
-
-	// nolint: errcheck
-	defer resp.Body.Close()
-
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		exitWithError("Failed to parse task metadata", err, logger)
+		exitWithError("Failed to configure session store", err, logger)
 	}
 
-	if taskID, ok := result["TaskARN"].(string); ok {
-		return taskID
-	}
-	exitWithError("Invalid task ARN received", nil, logger)
-	return ""
-}
+	w := watchdog.New(cfg, watchdog.Deps{
+		ECS:      ecs.NewFromConfig(awsCfg),
+		EC2:      ec2.NewFromConfig(awsCfg),
+		Route53:  route53.NewFromConfig(awsCfg),
+		Clock:    watchdog.RealClock{},
+		Metadata: watchdog.ECSMetadata{Endpoint: os.Getenv(taskMetaEndpoint)},
+		Ports:    watchdog.NetstatPorts{},
+		Java:     watchdog.JavaProbe{Addr: localAddr(cfg.QueryPortFor(watchdog.EditionJava))},
+		Bedrock:  watchdog.BedrockProbe{Addr: localAddr(cfg.QueryPortFor(watchdog.EditionBedrock))},
+		DialRCON: watchdog.NewRCONDialer(localAddr(cfg.RCONPort), cfg.RCONPassword),
+		Sessions: sessionStore,
 
-func resolvePublicIP(ecsClient *ecs.Client, ec2Client *ec2.Client, cfg *Config, taskID string, logger *slog.Logger) string {
-	resp, err := ecsClient.DescribeTasks(context.TODO(), &ecs.DescribeTasksInput{
-		Cluster: aws.String(cfg.Cluster),
-		Tasks:   []string{taskID},
-	})
-	if err != nil || len(resp.Tasks) == 0 {
-		exitWithError("Failed to describe ECS task", err, logger)
-	}
+		Notifiers: newNotifiers(cfg, awsCfg),
+		Resolvers: newResolverLearner(cfg, awsCfg),
+	}, logger)
 
-	var eni string
-	for _, detail := range resp.Tasks[0].Attachments[0].Details {
-		if detail.Name != nil && *detail.Name == "networkInterfaceId" {
-			eni = *detail.Value
-			break
-		}
-	}
+	serveStatus(w.Handler(), cfg.HTTPPort, logger)
 
-	respEC2, err := ec2Client.DescribeNetworkInterfaces(context.TODO(), &ec2.DescribeNetworkInterfacesInput{
-		NetworkInterfaceIds: []string{eni},
-	})
-	if err != nil {
-		exitWithError("Failed to describe network interfaces", err, logger)
-	}
-	return *respEC2.NetworkInterfaces[0].Association.PublicIp
-}
+	// ECS sends SIGTERM when it stops the task, Run then drains within STOP_TIMEOUT.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
-func updateDNSRecord(client *route53.Client, cfg *Config, publicIP string, logger *slog.Logger) {
-	_, err := client.ChangeResourceRecordSets(context.TODO(), &route53.ChangeResourceRecordSetsInput{
-		HostedZoneId: aws.String(cfg.DNSZone),
-		ChangeBatch: &types.ChangeBatch{
-			Changes: []types.Change{
-				{
-					Action: types.ChangeActionUpsert,
-					ResourceRecordSet: &types.ResourceRecordSet{
-						Name: aws.String(cfg.ServerName),
-						Type: types.RRTypeA,
-						TTL:  aws.Int64(30),
-						ResourceRecords: []types.ResourceRecord{
-							{Value: aws.String(publicIP)},
-						},
-					},
-				},
-			},
-		},
-	})
-	if err != nil {
-		exitWithError("Failed to update DNS record", err, logger)
+	if err := w.Run(ctx); err != nil {
+		exitWithError("Watchdog terminated", err, logger)
 	}
-	logger.Info("DNS record updated", slog.String("ServerName", cfg.ServerName), slog.String("IP", publicIP))
 }
 
-func determineEdition(cfg *Config, logger *slog.Logger) string {
-	logger.Info("Determining Minecraft edition based on listening port...")
-	counter := 0
-	for {
-		logger.Info("Checking ports for Minecraft server availability...",
-			"attempt", counter+1,
-			"javaPort", javaPort,
-			"bedrockPort", bedrockPort,
-		)
-
-		if isPortOpenAndListening(javaPort) { // Check Java port with LISTEN status
-			logger.Info("Detected Java Edition on port", "port", javaPort)
-			waitForRCON(logger)
-			return "java"
-		}
-
-		if isPortOpen(bedrockPort) { // Check Bedrock port without requiring LISTEN status
-			logger.Info("Detected Bedrock Edition on port", "port", bedrockPort)
-			return "bedrock"
-		}
-
-		time.Sleep(time.Second)
-		counter++
-
-		if counter > int(maxStartupWait.Seconds()) {
-			exitWithError("10 minutes elapsed without Minecraft server starting. Terminating.", nil, logger)
+// newSessionStore returns the player session store selected by SESSION_STORE.
+func newSessionStore(cfg watchdog.Config, awsCfg aws.Config) (sessions.Store, error) {
+	switch cfg.SessionStore {
+	case "jsonl":
+		return sessions.NewJSONLStore(cfg.SessionFile), nil
+	case "dynamodb":
+		if cfg.SessionTable == "" {
+			return nil, errors.New("SESSION_TABLE is required for the dynamodb session store")
 		}
+		return &sessions.DynamoDBStore{Client: dynamodb.NewFromConfig(awsCfg), Table: cfg.SessionTable}, nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown session store %q, want jsonl, dynamodb or none", cfg.SessionStore)
 	}
 }
 
-func isPortOpen(port int) bool {
-	conns, _ := psnet.Connections("all")
-	for _, conn := range conns {
-		if int(conn.Laddr.Port) == port {
-			return true
-		}
+// newNotifiers returns a notifier for every configured sink.
+func newNotifiers(cfg watchdog.Config, awsCfg aws.Config) []notify.Notifier {
+	var notifiers []notify.Notifier
+	if cfg.SNSTopic != "" {
+		notifiers = append(notifiers, &notify.SNS{Client: sns.NewFromConfig(awsCfg), TopicARN: cfg.SNSTopic})
 	}
-	return false
-}
-
-func isPortOpenAndListening(port int) bool {
-	conns, _ := psnet.Connections("all")
-	for _, conn := range conns {
-		if int(conn.Laddr.Port) == port && conn.Status == "LISTEN" {
-			return true
-		}
+	if cfg.DiscordWebhookURL != "" {
+		notifiers = append(notifiers, &notify.Discord{URL: cfg.DiscordWebhookURL})
 	}
-	return false
-}
-
-func waitForRCON(logger *slog.Logger) {
-	logger.Info("Waiting for Minecraft RCON to begin listening...")
-	for {
-		if isPortOpenAndListening(rconPort) {
-			logger.Info("RCON is listening, ready for clients.")
-			break
-		}
-		time.Sleep(rconWaitInterval)
+	if cfg.SlackWebhookURL != "" {
+		notifiers = append(notifiers, &notify.Slack{URL: cfg.SlackWebhookURL})
 	}
-}
-
-func waitForInitialClientConnection(cfg *Config, edition string, logger *slog.Logger) bool {
-	logger.Info("Checking every 1 minute for active connections to Minecraft...", slog.Int("minutes", cfg.StartupMin))
-	for counter := 0; counter < cfg.StartupMin; counter++ {
-		if isConnected(edition, logger) {
-			logger.Info("Initial connection established, proceeding to shutdown monitoring.")
-			return true
-		}
-		logger.Info(fmt.Sprintf("Waiting for connection, minute %d out of %d...", counter, cfg.StartupMin))
-		time.Sleep(checkInterval)
+	if cfg.WebhookURL != "" {
+		notifiers = append(notifiers, &notify.Webhook{URL: cfg.WebhookURL})
 	}
-	return false
+	return notifiers
 }
 
-func isConnected(edition string, logger *slog.Logger) bool {
-	if edition == "java" {
-		return checkConnections(javaPort) > 0
+// newResolverLearner returns the learned resolver store, or nil if
+// RESOLVER_TABLE is unset.
+func newResolverLearner(cfg watchdog.Config, awsCfg aws.Config) watchdog.ResolverLearner {
+	if cfg.ResolverTable == "" {
+		return nil
 	}
-	return sendBedrockPing(logger) > 0
+	return &resolvers.Store{Client: dynamodb.NewFromConfig(awsCfg), Table: cfg.ResolverTable, TTL: cfg.ResolverLearnTTL, Service: cfg.Service}
 }
 
-func sendBedrockPing(logger *slog.Logger) int {
-	conn, err := net.Dial("udp", bedrockIP)
-	if err != nil {
-		logger.Error("Failed to create UDP connection for Bedrock ping", slog.String("error", err.Error()))
-		return 0
-	}
-
-	// nolint:errcheck
-	defer conn.Close()
-
-	if _, err = conn.Write(buildBedrockPing()); err != nil {
-		logger.Error("Failed to send Bedrock ping packet", slog.String("error", err.Error()))
-		return 0
-	}
-
-	_ = conn.SetReadDeadline(time.Now().Add(bedrockPingWait))
-	buffer := make([]byte, 1024)
-	n, err := conn.Read(buffer)
-	if err != nil {
-		logger.Error("No response from server", slog.String("error", err.Error()))
-		return 0
-	}
-
-	// Parse response
-	if len(buffer[:n]) >= 34 {
-		parsedResponse := bytes.Split(buffer[34:n], []byte(";"))
-		if len(parsedResponse) > 4 {
-			playerCountStr := string(parsedResponse[4])
-			playerCount, err := strconv.Atoi(playerCountStr)
-			if err == nil && playerCount > 0 {
-				return playerCount // Players detected
-			}
-		}
-	}
-	return 0 // No players detected
+// localAddr returns the loopback address of port.
+func localAddr(port int) string {
+	return net.JoinHostPort(localhost, strconv.Itoa(port))
 }
 
-func buildBedrockPing() []byte {
-	ping := append([]byte{0x01}, []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x4e, 0x20}...)
-	ping = append(ping, []byte{0x00, 0xff, 0xff, 0x00, 0xfe, 0xfe, 0xfe, 0xfe, 0xfd, 0xfd, 0xfd, 0xfd, 0x12, 0x34, 0x56, 0x78}...)
-	guid := make([]byte, 8)
-	if _, err := rand.Read(guid); err == nil {
-		randomHex := make([]byte, hex.EncodedLen(len(guid)))
-		hex.Encode(randomHex, guid)
-		ping = append(ping, randomHex...)
+// serveStatus starts the status and metrics HTTP server in the background.
+func serveStatus(handler http.Handler, port int, logger *slog.Logger) {
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           handler,
+		ReadHeaderTimeout: statusReadTimeout,
 	}
-	return ping
-}
-
-func checkConnections(port int) int {
-	conns, _ := psnet.Connections("all")
-	count := 0
-	for _, conn := range conns {
-		if int(conn.Laddr.Port) == port && conn.Status == "ESTABLISHED" {
-			count++
+	go func() {
+		logger.Info("Starting status server", slog.Int("port", port))
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Status server failed", slog.String("error", err.Error()))
 		}
-	}
-	return count
+	}()
 }
 
-func monitorClientConnections(ecsClient *ecs.Client, snsClient *sns.Client, cfg *Config, edition string, logger *slog.Logger) {
-	logger.Info("Switching to shutdown monitor.")
-	counter := 0
-	for counter <= cfg.ShutdownMin {
-		if !isConnected(edition, logger) {
-			logger.Info(fmt.Sprintf("No active connections, %d out of %d minutes", counter, cfg.ShutdownMin))
-			counter++
-		} else {
-			logger.Info("Active connections detected, resetting counter.")
-			counter = 0
-		}
-		time.Sleep(checkInterval)
-	}
-	logger.Info(fmt.Sprintf("%d minutes elapsed without a connection, terminating.", cfg.ShutdownMin))
-	shutdownService(ecsClient, snsClient, cfg, logger)
-}
+// runHealthCheck queries the local /healthz endpoint and returns a process exit code.
+// It backs the container health check, as the scratch image ships no HTTP client.
+func runHealthCheck(port int) int {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckWait)
+	defer cancel()
 
-func shutdownService(ecsClient *ecs.Client, snsClient *sns.Client, cfg *Config, logger *slog.Logger) {
-	sendShutdownNotification(snsClient, cfg, logger)
-	_, err := ecsClient.UpdateService(context.TODO(), &ecs.UpdateServiceInput{
-		Cluster:      aws.String(cfg.Cluster),
-		Service:      aws.String(cfg.Service),
-		DesiredCount: aws.Int32(0),
-	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/healthz", port), nil)
 	if err != nil {
-		exitWithError("Failed to set service desired count to zero", err, logger)
+		return 1
 	}
-	logger.Info("Service shutdown initiated")
-}
-
-func sendStartupNotification(client *sns.Client, cfg *Config, edition, publicIP string, logger *slog.Logger) {
-	if cfg.SNSTopic == "" {
-		return
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 1
 	}
-	message := fmt.Sprintf(
-		"Server is online.\nService: %s\nEdition: %s\nAddress: %s (%s)\nCluster: %s\nTime: %s",
-		cfg.Service, edition, cfg.ServerName, publicIP, cfg.Cluster, time.Now().Format(time.RFC1123),
-	)
-	_, _ = client.Publish(context.TODO(), &sns.PublishInput{
-		TopicArn: aws.String(cfg.SNSTopic),
-		Message:  aws.String(message),
-	})
-}
 
-func sendShutdownNotification(client *sns.Client, cfg *Config, logger *slog.Logger) {
-	if cfg.SNSTopic == "" {
-		return
+	// nolint: errcheck
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 1
 	}
-	message := fmt.Sprintf(
-		"Shutting down server.\nService: %s\nAddress: %s\nCluster: %s\nTime: %s",
-		cfg.Service, cfg.ServerName, cfg.Cluster, time.Now().Format(time.RFC1123),
-	)
-	_, _ = client.Publish(context.TODO(), &sns.PublishInput{
-		TopicArn: aws.String(cfg.SNSTopic),
-		Message:  aws.String(message),
-	})
+	return 0
 }
 
 func exitWithError(msg string, err error, logger *slog.Logger) {
@@ -0,0 +1,68 @@
+// Package capacity maps the configured capacity mode of the server to ECS
+// Fargate capacity providers.
+package capacity
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// Mode selects the capacity the server task runs on.
+type Mode string
+
+// Capacity modes.
+const (
+	// Fargate always runs on on-demand capacity.
+	Fargate Mode = "fargate"
+	// Spot always runs on Fargate Spot capacity.
+	Spot Mode = "spot"
+	// SpotWithFallback runs on Fargate Spot and moves the session to on-demand
+	// capacity after a Spot interruption until the service is scaled to zero.
+	SpotWithFallback Mode = "spot-fallback"
+)
+
+// Fargate capacity providers.
+const (
+	ProviderFargate     = "FARGATE"
+	ProviderFargateSpot = "FARGATE_SPOT"
+)
+
+// ParseMode parses s as a capacity mode.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case Fargate, Spot, SpotWithFallback:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown capacity mode %q, want %s, %s or %s", s, Fargate, Spot, SpotWithFallback)
+	}
+}
+
+// Provider returns the capacity provider a new session starts on.
+func (m Mode) Provider() string {
+	if m == Fargate {
+		return ProviderFargate
+	}
+	return ProviderFargateSpot
+}
+
+// Strategy returns a capacity provider strategy placing all tasks on provider.
+func Strategy(provider string) []types.CapacityProviderStrategyItem {
+	return []types.CapacityProviderStrategyItem{
+		{
+			CapacityProvider: aws.String(provider),
+			Weight:           1,
+			Base:             1,
+		},
+	}
+}
+
+// CurrentProvider returns the provider of a single-provider strategy, or an
+// empty string if the strategy is empty or mixes providers.
+func CurrentProvider(strategy []types.CapacityProviderStrategyItem) string {
+	if len(strategy) != 1 {
+		return ""
+	}
+	return aws.ToString(strategy[0].CapacityProvider)
+}
@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Limits of a Discord embed, longer values are truncated.
+const (
+	discordMaxTitle      = 256
+	discordMaxFields     = 25
+	discordMaxFieldName  = 256
+	discordMaxFieldValue = 1024
+)
+
+// discordColors maps events to the colour of the embed's side bar.
+var discordColors = map[Event]int{
+	EventStarting:       0xf1c40f, // yellow
+	EventStartup:        0x2ecc71, // green
+	EventShutdown:       0x95a5a6, // grey
+	EventUnexpectedStop: 0xe74c3c, // red
+}
+
+// Discord posts notifications as a rich embed to a Discord webhook.
+type Discord struct {
+	URL    string
+	Client *http.Client
+}
+
+type discordPayload struct {
+	Embeds []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title     string         `json:"title"`
+	Color     int            `json:"color,omitempty"`
+	Fields    []discordField `json:"fields,omitempty"`
+	Timestamp string         `json:"timestamp,omitempty"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// Name returns "discord".
+func (d *Discord) Name() string { return "discord" }
+
+// Notify posts n as an embed. Fields are shown inline, sections as full width
+// bulleted fields below them.
+func (d *Discord) Notify(ctx context.Context, n Notification) error {
+	embed := discordEmbed{
+		Title:     truncate(n.Title, discordMaxTitle),
+		Color:     discordColors[n.Event],
+		Timestamp: n.Time.UTC().Format(time.RFC3339),
+	}
+	for _, field := range n.Fields {
+		embed.Fields = append(embed.Fields, discordField{
+			Name:   truncate(field.Name, discordMaxFieldName),
+			Value:  truncate(field.Value, discordMaxFieldValue),
+			Inline: true,
+		})
+	}
+	for _, section := range n.Sections {
+		if len(section.Items) == 0 {
+			continue
+		}
+		embed.Fields = append(embed.Fields, discordField{
+			Name:  truncate(section.Title, discordMaxFieldName),
+			Value: truncate("- "+strings.Join(section.Items, "\n- "), discordMaxFieldValue),
+		})
+	}
+	if len(embed.Fields) > discordMaxFields {
+		embed.Fields = embed.Fields[:discordMaxFields]
+	}
+	return postJSON(ctx, d.Client, d.URL, discordPayload{Embeds: []discordEmbed{embed}})
+}
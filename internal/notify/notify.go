@@ -0,0 +1,127 @@
+// Package notify delivers server notifications to SNS and chat webhooks.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Event identifies what a notification is about.
+type Event string
+
+// Events sent by the launcher and the watchdog.
+const (
+	EventStarting       Event = "starting"
+	EventStartup        Event = "startup"
+	EventShutdown       Event = "shutdown"
+	EventUnexpectedStop Event = "unexpected_stop"
+)
+
+// Events lists all events, e.g. to validate subscription filters.
+var Events = []Event{EventStarting, EventStartup, EventShutdown, EventUnexpectedStop}
+
+// ParseEvent returns the event named s.
+func ParseEvent(s string) (Event, error) {
+	switch e := Event(s); e {
+	case EventStarting, EventStartup, EventShutdown, EventUnexpectedStop:
+		return e, nil
+	default:
+		return "", fmt.Errorf("unknown event %q, want %s, %s, %s or %s", s, EventStarting, EventStartup, EventShutdown, EventUnexpectedStop)
+	}
+}
+
+// PayloadVersion is the version of the JSON payload. It is incremented on
+// incompatible changes only, new fields may be added at any time.
+const PayloadVersion = 1
+
+// Field is a single key/value line of a notification, e.g. the server address.
+type Field struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Section is a titled list, e.g. the steps of the shutdown sequence.
+type Section struct {
+	Title string   `json:"title"`
+	Items []string `json:"items"`
+}
+
+// Notification is a sink independent server notification. Sinks render it in
+// their native format, Text renders it as plain text and Payload as JSON.
+type Notification struct {
+	Event Event
+	Title string
+	// Service, Edition, Address and Players describe the server for machine
+	// readable payloads. Edition is empty if it is not known yet.
+	Service string
+	Edition string
+	Address string
+	Players []string
+	// Fields and Sections are the human readable details.
+	Fields   []Field
+	Sections []Section
+	Time     time.Time
+}
+
+// Payload is the versioned JSON representation of a notification.
+type Payload struct {
+	Version   int       `json:"version"`
+	EventType Event     `json:"event_type"`
+	Service   string    `json:"service"`
+	Edition   string    `json:"edition,omitempty"`
+	Address   string    `json:"address"`
+	Players   []string  `json:"players"`
+	Timestamp time.Time `json:"timestamp"`
+	Title     string    `json:"title"`
+	Fields    []Field   `json:"fields,omitempty"`
+	Sections  []Section `json:"sections,omitempty"`
+	Text      string    `json:"text"`
+}
+
+// Notifier delivers notifications to a single sink.
+type Notifier interface {
+	// Name identifies the sink in logs and metrics.
+	Name() string
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Payload returns the JSON representation of n.
+func (n Notification) Payload() Payload {
+	players := n.Players
+	if players == nil {
+		players = []string{}
+	}
+	return Payload{
+		Version:   PayloadVersion,
+		EventType: n.Event,
+		Service:   n.Service,
+		Edition:   n.Edition,
+		Address:   n.Address,
+		Players:   players,
+		Timestamp: n.Time.UTC(),
+		Title:     n.Title,
+		Fields:    n.Fields,
+		Sections:  n.Sections,
+		Text:      n.Text(),
+	}
+}
+
+// Text renders n as plain text, one field per line followed by the sections
+// as bulleted lists.
+func (n Notification) Text() string {
+	var b strings.Builder
+	b.WriteString(n.Title)
+	for _, field := range n.Fields {
+		fmt.Fprintf(&b, "\n%s: %s", field.Name, field.Value)
+	}
+	fmt.Fprintf(&b, "\nTime: %s", n.Time.Format(time.RFC1123))
+	for _, section := range n.Sections {
+		if len(section.Items) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s:\n- %s", section.Title, strings.Join(section.Items, "\n- "))
+	}
+	return b.String()
+}
@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Limits of Slack Block Kit, longer values are truncated.
+const (
+	slackMaxHeader        = 150
+	slackMaxSectionFields = 10
+	slackMaxText          = 3000
+)
+
+// Slack posts notifications to a Slack incoming webhook using Block Kit.
+type Slack struct {
+	URL    string
+	Client *http.Client
+}
+
+type slackPayload struct {
+	// Text is shown in push notifications and clients without block support.
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Fields   []slackText `json:"fields,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Name returns "slack".
+func (s *Slack) Name() string { return "slack" }
+
+// Notify posts n as a header followed by its fields in two columns and one
+// section per list.
+func (s *Slack) Notify(ctx context.Context, n Notification) error {
+	blocks := []slackBlock{{
+		Type: "header",
+		Text: &slackText{Type: "plain_text", Text: truncate(n.Title, slackMaxHeader)},
+	}}
+	for start := 0; start < len(n.Fields); start += slackMaxSectionFields {
+		block := slackBlock{Type: "section"}
+		for _, field := range n.Fields[start:min(start+slackMaxSectionFields, len(n.Fields))] {
+			block.Fields = append(block.Fields, slackText{
+				Type: "mrkdwn",
+				Text: truncate(fmt.Sprintf("*%s*\n%s", field.Name, field.Value), slackMaxText),
+			})
+		}
+		blocks = append(blocks, block)
+	}
+	for _, section := range n.Sections {
+		if len(section.Items) == 0 {
+			continue
+		}
+		blocks = append(blocks, slackBlock{
+			Type: "section",
+			Text: &slackText{
+				Type: "mrkdwn",
+				Text: truncate(fmt.Sprintf("*%s*\n• %s", section.Title, strings.Join(section.Items, "\n• ")), slackMaxText),
+			},
+		})
+	}
+	blocks = append(blocks, slackBlock{
+		Type:     "context",
+		Elements: []slackText{{Type: "mrkdwn", Text: fmt.Sprintf("<!date^%d^{date_short_pretty} {time}|%s>", n.Time.Unix(), n.Time.UTC().Format("2006-01-02 15:04 UTC"))}},
+	})
+	return postJSON(ctx, s.Client, s.URL, slackPayload{Text: n.Title, Blocks: blocks})
+}
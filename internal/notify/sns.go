@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// Message attributes set on every published notification. Subscriptions can
+// filter on them, e.g. {"event_type": ["unexpected_stop"]}.
+const (
+	AttributeEventType = "event_type"
+	AttributeService   = "service"
+	AttributeEdition   = "edition"
+	AttributeVersion   = "version"
+)
+
+// SNSAPI is the subset of the SNS client used by the SNS notifier.
+type SNSAPI interface {
+	Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// SNS publishes notifications to an SNS topic. Email subscribers receive the
+// plain text, SMS subscribers the title and all other protocols the JSON
+// Payload.
+type SNS struct {
+	Client   SNSAPI
+	TopicARN string
+}
+
+// Name returns "sns".
+func (s *SNS) Name() string { return "sns" }
+
+// Notify publishes n to the topic.
+func (s *SNS) Notify(ctx context.Context, n Notification) error {
+	message, err := snsMessage(n)
+	if err != nil {
+		return err
+	}
+	_, err = s.Client.Publish(ctx, &sns.PublishInput{
+		TopicArn:          aws.String(s.TopicARN),
+		Subject:           aws.String(subject(n.Title)),
+		Message:           aws.String(message),
+		MessageStructure:  aws.String("json"),
+		MessageAttributes: snsAttributes(n),
+	})
+	return err
+}
+
+// snsMessage returns the per-protocol message. The default applies to every
+// protocol without an explicit entry, e.g. sqs, lambda and https.
+func snsMessage(n Notification) (string, error) {
+	payload, err := json.Marshal(n.Payload())
+	if err != nil {
+		return "", fmt.Errorf("failed to encode payload: %w", err)
+	}
+	message, err := json.Marshal(map[string]string{
+		"default": string(payload),
+		"email":   n.Text(),
+		"sms":     n.Title,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode message: %w", err)
+	}
+	return string(message), nil
+}
+
+// snsAttributes returns the message attributes of n. SNS rejects empty string
+// attributes, so unknown values are omitted.
+func snsAttributes(n Notification) map[string]types.MessageAttributeValue {
+	attributes := map[string]types.MessageAttributeValue{
+		AttributeVersion: {DataType: aws.String("Number"), StringValue: aws.String(strconv.Itoa(PayloadVersion))},
+	}
+	for name, value := range map[string]string{
+		AttributeEventType: string(n.Event),
+		AttributeService:   n.Service,
+		AttributeEdition:   n.Edition,
+	} {
+		if value != "" {
+			attributes[name] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(value)}
+		}
+	}
+	return attributes
+}
+
+// subject shortens title to the 100 characters SNS allows in email subjects.
+func subject(title string) string {
+	const maxSubject = 100
+	return truncate(title, maxSubject)
+}
@@ -0,0 +1,89 @@
+// Package querylog parses Route53 public DNS query log records.
+//
+// A record is a single space separated line:
+//
+//	1.0 2017-12-13T08:16:02.130Z Z123412341234 example.com A NOERROR UDP FRA6 192.168.1.1 -
+//
+// See https://docs.aws.amazon.com/Route53/latest/DeveloperGuide/query-logs.html.
+package querylog
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+const (
+	// version is the only log format version Route53 has published. Records
+	// of other versions are rejected, as their fields may have moved.
+	version = "1.0"
+	// numFields is the number of fields of a version 1.0 record.
+	numFields = 10
+)
+
+// ErrInvalidRecord is returned when a line is not a query log record.
+var ErrInvalidRecord = errors.New("querylog: invalid record")
+
+// Record is a single DNS query answered by Route53.
+type Record struct {
+	// Version is the log format version, always "1.0".
+	Version string
+	// Time is when Route53 responded to the query.
+	Time time.Time
+	// HostedZoneID is the hosted zone the query was answered from.
+	HostedZoneID string
+	// Name is the queried domain name without the trailing dot, in lower case.
+	Name string
+	// Type is the queried record type, e.g. "A" or "SRV".
+	Type string
+	// ResponseCode is the DNS response code, e.g. "NOERROR" or "NXDOMAIN".
+	ResponseCode string
+	// Protocol is the transport of the query, "UDP" or "TCP".
+	Protocol string
+	// EdgeLocation is the Route53 edge location, e.g. "FRA6".
+	EdgeLocation string
+	// ResolverIP is the resolver that sent the query to Route53.
+	ResolverIP netip.Addr
+	// EDNSClientSubnet is the client subnet forwarded by the resolver, empty
+	// if the resolver does not support EDNS0 client subnet.
+	EDNSClientSubnet string
+}
+
+// Parse decodes a single query log record.
+func Parse(line string) (Record, error) {
+	fields := strings.Fields(line)
+	if len(fields) != numFields {
+		return Record{}, fmt.Errorf("%w: %d fields, want %d", ErrInvalidRecord, len(fields), numFields)
+	}
+	if fields[0] != version {
+		return Record{}, fmt.Errorf("%w: version %q, want %s", ErrInvalidRecord, fields[0], version)
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, fields[1])
+	if err != nil {
+		return Record{}, fmt.Errorf("%w: timestamp %q", ErrInvalidRecord, fields[1])
+	}
+	resolver, err := netip.ParseAddr(fields[8])
+	if err != nil {
+		return Record{}, fmt.Errorf("%w: resolver IP %q", ErrInvalidRecord, fields[8])
+	}
+	subnet := fields[9]
+	if subnet == "-" {
+		subnet = ""
+	}
+
+	return Record{
+		Version:          fields[0],
+		Time:             t,
+		HostedZoneID:     fields[2],
+		Name:             strings.ToLower(strings.TrimSuffix(fields[3], ".")),
+		Type:             strings.ToUpper(fields[4]),
+		ResponseCode:     fields[5],
+		Protocol:         fields[6],
+		EdgeLocation:     fields[7],
+		ResolverIP:       resolver.Unmap(),
+		EDNSClientSubnet: subnet,
+	}, nil
+}
@@ -0,0 +1,141 @@
+package querylog
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Record
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			line: "1.0 2017-12-13T08:16:02.130Z Z123412341234 mc.example.com A NOERROR UDP FRA6 192.168.1.1 -",
+			want: Record{
+				Version:      "1.0",
+				Time:         time.Date(2017, 12, 13, 8, 16, 2, 130_000_000, time.UTC),
+				HostedZoneID: "Z123412341234",
+				Name:         "mc.example.com",
+				Type:         "A",
+				ResponseCode: "NOERROR",
+				Protocol:     "UDP",
+				EdgeLocation: "FRA6",
+				ResolverIP:   netip.MustParseAddr("192.168.1.1"),
+			},
+		},
+		{
+			name: "trailing dot and mixed case name",
+			line: "1.0 2017-12-13T08:16:02.130Z Z123412341234 Mc.Example.COM. A NOERROR UDP FRA6 192.168.1.1 -",
+			want: Record{
+				Version:      "1.0",
+				Time:         time.Date(2017, 12, 13, 8, 16, 2, 130_000_000, time.UTC),
+				HostedZoneID: "Z123412341234",
+				Name:         "mc.example.com",
+				Type:         "A",
+				ResponseCode: "NOERROR",
+				Protocol:     "UDP",
+				EdgeLocation: "FRA6",
+				ResolverIP:   netip.MustParseAddr("192.168.1.1"),
+			},
+		},
+		{
+			name: "lower case type and client subnet",
+			line: "1.0 2017-12-13T08:16:02.130Z Z123412341234 _minecraft._tcp.mc.example.com srv NXDOMAIN TCP IAD89-C1 198.51.100.7 203.0.113.0/24",
+			want: Record{
+				Version:          "1.0",
+				Time:             time.Date(2017, 12, 13, 8, 16, 2, 130_000_000, time.UTC),
+				HostedZoneID:     "Z123412341234",
+				Name:             "_minecraft._tcp.mc.example.com",
+				Type:             "SRV",
+				ResponseCode:     "NXDOMAIN",
+				Protocol:         "TCP",
+				EdgeLocation:     "IAD89-C1",
+				ResolverIP:       netip.MustParseAddr("198.51.100.7"),
+				EDNSClientSubnet: "203.0.113.0/24",
+			},
+		},
+		{
+			name: "ipv6 resolver",
+			line: "1.0 2017-12-13T08:16:02Z Z123412341234 mc.example.com AAAA NOERROR UDP FRA56-P1 2001:db8::53 -",
+			want: Record{
+				Version:      "1.0",
+				Time:         time.Date(2017, 12, 13, 8, 16, 2, 0, time.UTC),
+				HostedZoneID: "Z123412341234",
+				Name:         "mc.example.com",
+				Type:         "AAAA",
+				ResponseCode: "NOERROR",
+				Protocol:     "UDP",
+				EdgeLocation: "FRA56-P1",
+				ResolverIP:   netip.MustParseAddr("2001:db8::53"),
+			},
+		},
+		{
+			name: "ipv4-mapped resolver",
+			line: "1.0 2017-12-13T08:16:02Z Z123412341234 mc.example.com A NOERROR UDP FRA6 ::ffff:192.0.2.1 -",
+			want: Record{
+				Version:      "1.0",
+				Time:         time.Date(2017, 12, 13, 8, 16, 2, 0, time.UTC),
+				HostedZoneID: "Z123412341234",
+				Name:         "mc.example.com",
+				Type:         "A",
+				ResponseCode: "NOERROR",
+				Protocol:     "UDP",
+				EdgeLocation: "FRA6",
+				ResolverIP:   netip.MustParseAddr("192.0.2.1"),
+			},
+		},
+		{
+			name:    "nine fields",
+			line:    "1.0 2017-12-13T08:16:02.130Z Z123412341234 mc.example.com A NOERROR UDP FRA6 192.168.1.1",
+			wantErr: true,
+		},
+		{
+			name:    "eleven fields",
+			line:    "1.0 2017-12-13T08:16:02.130Z Z123412341234 mc.example.com A NOERROR UDP FRA6 192.168.1.1 - extra",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			line:    "",
+			wantErr: true,
+		},
+		{
+			name:    "other version",
+			line:    "2.0 2017-12-13T08:16:02.130Z Z123412341234 mc.example.com A NOERROR UDP FRA6 192.168.1.1 -",
+			wantErr: true,
+		},
+		{
+			name:    "bad timestamp",
+			line:    "1.0 13/12/2017 Z123412341234 mc.example.com A NOERROR UDP FRA6 192.168.1.1 -",
+			wantErr: true,
+		},
+		{
+			name:    "bad resolver ip",
+			line:    "1.0 2017-12-13T08:16:02.130Z Z123412341234 mc.example.com A NOERROR UDP FRA6 192.168.1 -",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.line)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidRecord) {
+					t.Fatalf("Parse(%q) error = %v, want %v", tt.line, err, ErrInvalidRecord)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.line, err)
+			}
+			if got != tt.want {
+				t.Fatalf("Parse(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+// Package raknet implements the RakNet unconnected ping/pong exchange used to
+// query the status of a Minecraft Bedrock Edition server.
+package raknet
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	idUnconnectedPing = 0x01
+	idUnconnectedPong = 0x1c
+
+	// pongHeaderSize is ID(1) + time(8) + server GUID(8) + magic(16) + string length(2).
+	pongHeaderSize = 1 + 8 + 8 + 16 + 2
+	maxDatagram    = 1500
+
+	defaultTimeout = 5 * time.Second
+)
+
+// magic is the offline message ID every unconnected RakNet packet carries.
+var magic = [16]byte{0x00, 0xff, 0xff, 0x00, 0xfe, 0xfe, 0xfe, 0xfe, 0xfd, 0xfd, 0xfd, 0xfd, 0x12, 0x34, 0x56, 0x78}
+
+var (
+	// ErrUnexpectedPacket is returned when the response is not an unconnected pong.
+	ErrUnexpectedPacket = errors.New("raknet: unexpected packet id")
+	// ErrInvalidMagic is returned when the offline message magic does not match.
+	ErrInvalidMagic = errors.New("raknet: invalid magic")
+	// ErrShortPacket is returned when the packet ends before a field is complete.
+	ErrShortPacket = errors.New("raknet: packet too short")
+	// ErrInvalidServerID is returned when the server ID string cannot be decoded.
+	ErrInvalidServerID = errors.New("raknet: invalid server id")
+)
+
+// Pong is a decoded unconnected pong.
+type Pong struct {
+	// Time echoes the time sent in the ping.
+	Time int64
+	// GUID is the server GUID from the RakNet header.
+	GUID uint64
+	// Status is the decoded server ID string.
+	Status Status
+}
+
+// Status holds the fields of the semicolon separated server ID string.
+// Fields after MaxPlayers are optional and left zero if the server omits them.
+type Status struct {
+	Edition    string `json:"edition"`
+	MOTD       string `json:"motd"`
+	Protocol   int    `json:"protocol"`
+	Version    string `json:"version"`
+	Players    int    `json:"players"`
+	MaxPlayers int    `json:"max_players"`
+	ServerID   string `json:"server_id,omitempty"`
+	LevelName  string `json:"level_name,omitempty"`
+	GameMode   string `json:"game_mode,omitempty"`
+	GameModeID int    `json:"game_mode_id,omitempty"`
+	PortIPv4   int    `json:"port_ipv4,omitempty"`
+	PortIPv6   int    `json:"port_ipv6,omitempty"`
+}
+
+// Ping sends an unconnected ping to addr (host:port) and returns the decoded pong.
+// If ctx has no deadline, a default timeout of five seconds is applied.
+func Ping(ctx context.Context, addr string) (*Pong, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultTimeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("raknet: dial: %w", err)
+	}
+
+	// nolint: errcheck
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	var guid [8]byte
+	if _, err := rand.Read(guid[:]); err != nil {
+		return nil, fmt.Errorf("raknet: generate client guid: %w", err)
+	}
+	sent := time.Now().UnixMilli()
+	if _, err := conn.Write(AppendPing(nil, sent, binary.BigEndian.Uint64(guid[:]))); err != nil {
+		return nil, fmt.Errorf("raknet: write ping: %w", err)
+	}
+
+	buf := make([]byte, maxDatagram)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, fmt.Errorf("raknet: read pong: %w", err)
+	}
+	return ParsePong(buf[:n])
+}
+
+// AppendPing appends an unconnected ping carrying t and the client GUID to buf.
+func AppendPing(buf []byte, t int64, clientGUID uint64) []byte {
+	buf = append(buf, idUnconnectedPing)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(t))
+	buf = append(buf, magic[:]...)
+	return binary.BigEndian.AppendUint64(buf, clientGUID)
+}
+
+// AppendPong appends an unconnected pong to buf. The server ID string is
+// encoded from p.Status.
+func AppendPong(buf []byte, p *Pong) []byte {
+	id := p.Status.String()
+	buf = append(buf, idUnconnectedPong)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(p.Time))
+	buf = binary.BigEndian.AppendUint64(buf, p.GUID)
+	buf = append(buf, magic[:]...)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(id)))
+	return append(buf, id...)
+}
+
+// ParsePong decodes an unconnected pong packet.
+func ParsePong(b []byte) (*Pong, error) {
+	if len(b) < pongHeaderSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrShortPacket, len(b))
+	}
+	if b[0] != idUnconnectedPong {
+		return nil, fmt.Errorf("%w: got 0x%02x, want 0x%02x", ErrUnexpectedPacket, b[0], idUnconnectedPong)
+	}
+	pong := &Pong{
+		Time: int64(binary.BigEndian.Uint64(b[1:9])),
+		GUID: binary.BigEndian.Uint64(b[9:17]),
+	}
+	if !bytes.Equal(b[17:33], magic[:]) {
+		return nil, ErrInvalidMagic
+	}
+	length := int(binary.BigEndian.Uint16(b[33:35]))
+	if len(b)-pongHeaderSize < length {
+		return nil, fmt.Errorf("%w: server id needs %d bytes, have %d", ErrShortPacket, length, len(b)-pongHeaderSize)
+	}
+
+	status, err := ParseStatus(string(b[pongHeaderSize : pongHeaderSize+length]))
+	if err != nil {
+		return nil, err
+	}
+	pong.Status = *status
+	return pong, nil
+}
+
+// ParseStatus decodes a server ID string such as
+// "MCPE;Dedicated Server;712;1.21.20;0;10;13253860892328930865;Bedrock level;Survival;1;19132;19133;".
+func ParseStatus(s string) (*Status, error) {
+	fields := strings.Split(strings.TrimSuffix(s, ";"), ";")
+	if len(fields) < 6 {
+		return nil, fmt.Errorf("%w: %d fields, want at least 6", ErrInvalidServerID, len(fields))
+	}
+
+	status := &Status{
+		Edition: fields[0],
+		MOTD:    fields[1],
+		Version: fields[3],
+	}
+	var err error
+	if status.Protocol, err = atoi(fields[2], "protocol"); err != nil {
+		return nil, err
+	}
+	if status.Players, err = atoi(fields[4], "players"); err != nil {
+		return nil, err
+	}
+	if status.MaxPlayers, err = atoi(fields[5], "max players"); err != nil {
+		return nil, err
+	}
+
+	optional := []struct {
+		str  *string
+		num  *int
+		name string
+	}{
+		{str: &status.ServerID},
+		{str: &status.LevelName},
+		{str: &status.GameMode},
+		{num: &status.GameModeID, name: "game mode id"},
+		{num: &status.PortIPv4, name: "ipv4 port"},
+		{num: &status.PortIPv6, name: "ipv6 port"},
+	}
+	for i, field := range fields[6:] {
+		if i >= len(optional) {
+			break
+		}
+		switch target := optional[i]; {
+		case target.str != nil:
+			*target.str = field
+		case field != "":
+			if *target.num, err = atoi(field, target.name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return status, nil
+}
+
+// String encodes s as a server ID string.
+func (s Status) String() string {
+	fields := []string{
+		s.Edition,
+		s.MOTD,
+		strconv.Itoa(s.Protocol),
+		s.Version,
+		strconv.Itoa(s.Players),
+		strconv.Itoa(s.MaxPlayers),
+		s.ServerID,
+		s.LevelName,
+		s.GameMode,
+		strconv.Itoa(s.GameModeID),
+		strconv.Itoa(s.PortIPv4),
+		strconv.Itoa(s.PortIPv6),
+	}
+	return strings.Join(fields, ";") + ";"
+}
+
+func atoi(s, name string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s %q is not a number", ErrInvalidServerID, name, s)
+	}
+	return n, nil
+}
@@ -0,0 +1,213 @@
+package raknet
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Golden pongs of a vanilla Bedrock Dedicated Server and of a Geyser proxy in
+// front of a Java server.
+var goldenPongs = []struct {
+	file string
+	want Pong
+}{
+	{
+		file: "bds.pong",
+		want: Pong{
+			Time: 1718030400123,
+			GUID: 13253860892328930865,
+			Status: Status{
+				Edition:    "MCPE",
+				MOTD:       "Dedicated Server",
+				Protocol:   712,
+				Version:    "1.21.20",
+				Players:    0,
+				MaxPlayers: 10,
+				ServerID:   "13253860892328930865",
+				LevelName:  "Bedrock level",
+				GameMode:   "Survival",
+				GameModeID: 1,
+				PortIPv4:   19132,
+				PortIPv6:   19133,
+			},
+		},
+	},
+	{
+		file: "geyser.pong",
+		want: Pong{
+			Time: 1718030400456,
+			GUID: 2246898226347801992,
+			Status: Status{
+				Edition:    "MCPE",
+				MOTD:       "§bGeyser Proxy",
+				Protocol:   686,
+				Version:    "1.21.2",
+				Players:    3,
+				MaxPlayers: 100,
+				ServerID:   "2246898226347801992",
+				LevelName:  "§7Java server",
+				GameMode:   "Survival",
+				GameModeID: 1,
+				PortIPv4:   19132,
+				PortIPv6:   19132,
+			},
+		},
+	},
+}
+
+func readGolden(t testing.TB, file string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParsePongGolden(t *testing.T) {
+	for _, tt := range goldenPongs {
+		t.Run(tt.file, func(t *testing.T) {
+			got, err := ParsePong(readGolden(t, tt.file))
+			if err != nil {
+				t.Fatalf("ParsePong(): %v", err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Fatalf("ParsePong() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendPongGolden(t *testing.T) {
+	for _, tt := range goldenPongs {
+		t.Run(tt.file, func(t *testing.T) {
+			want := readGolden(t, tt.file)
+			if got := AppendPong(nil, &tt.want); string(got) != string(want) {
+				t.Fatalf("AppendPong() = % x, want % x", got, want)
+			}
+		})
+	}
+}
+
+func TestPongRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		pong Pong
+	}{
+		{
+			name: "required fields only",
+			pong: Pong{Time: 1, GUID: 2, Status: Status{
+				Edition: "MCPE", MOTD: "Server", Protocol: 712, Version: "1.21.20", Players: 1, MaxPlayers: 10,
+			}},
+		},
+		{
+			name: "all fields",
+			pong: goldenPongs[0].want,
+		},
+		{
+			name: "negative time",
+			pong: Pong{Time: -1, GUID: 1<<64 - 1, Status: Status{Edition: "MCEE", MaxPlayers: 40}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePong(AppendPong(nil, &tt.pong))
+			if err != nil {
+				t.Fatalf("ParsePong(AppendPong()): %v", err)
+			}
+			if !reflect.DeepEqual(*got, tt.pong) {
+				t.Fatalf("ParsePong(AppendPong()) = %+v, want %+v", *got, tt.pong)
+			}
+		})
+	}
+}
+
+func TestParsePongErrors(t *testing.T) {
+	valid := readGolden(t, "bds.pong")
+	modified := func(fn func(b []byte) []byte) []byte {
+		return fn(append([]byte(nil), valid...))
+	}
+
+	tests := []struct {
+		name    string
+		packet  []byte
+		wantErr error
+	}{
+		{
+			name:    "empty",
+			packet:  nil,
+			wantErr: ErrShortPacket,
+		},
+		{
+			name:    "truncated header",
+			packet:  valid[:pongHeaderSize-1],
+			wantErr: ErrShortPacket,
+		},
+		{
+			name:    "truncated motd",
+			packet:  valid[:pongHeaderSize+10],
+			wantErr: ErrShortPacket,
+		},
+		{
+			name:    "ping instead of pong",
+			packet:  modified(func(b []byte) []byte { b[0] = idUnconnectedPing; return b }),
+			wantErr: ErrUnexpectedPacket,
+		},
+		{
+			name:    "wrong magic",
+			packet:  modified(func(b []byte) []byte { b[20] ^= 0xff; return b }),
+			wantErr: ErrInvalidMagic,
+		},
+		{
+			name:    "server id with too few fields",
+			packet:  pongWithServerID("MCPE;Dedicated Server;712;1.21.20;0;"),
+			wantErr: ErrInvalidServerID,
+		},
+		{
+			name:    "non-numeric player count",
+			packet:  pongWithServerID("MCPE;Dedicated Server;712;1.21.20;many;10;"),
+			wantErr: ErrInvalidServerID,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParsePong(tt.packet); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParsePong() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// pongWithServerID returns a pong carrying id verbatim.
+func pongWithServerID(id string) []byte {
+	b := AppendPong(nil, &Pong{})
+	b = b[:pongHeaderSize-2]
+	b = append(b, byte(len(id)>>8), byte(len(id)))
+	return append(b, id...)
+}
+
+func FuzzParsePong(f *testing.F) {
+	for _, tt := range goldenPongs {
+		f.Add(readGolden(f, tt.file))
+	}
+	f.Add(AppendPong(nil, &Pong{}))
+	f.Add(pongWithServerID("MCPE;;0;;0;0"))
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		pong, err := ParsePong(b)
+		if err != nil {
+			return
+		}
+		// Whatever parses must survive a round trip unchanged.
+		got, err := ParsePong(AppendPong(nil, pong))
+		if err != nil {
+			t.Fatalf("ParsePong(AppendPong(%+v)): %v", *pong, err)
+		}
+		if !reflect.DeepEqual(got, pong) {
+			t.Fatalf("ParsePong(AppendPong()) = %+v, want %+v", *got, *pong)
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package rcon
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PlayerList is the parsed response of the list command.
+type PlayerList struct {
+	Online int
+	Max    int
+	Names  []string
+}
+
+// listPattern matches both "There are 1 of a max of 20 players online: Steve"
+// and the older "There are 1/20 players online:Steve" formats.
+var listPattern = regexp.MustCompile(`There are (\d+)(?: of a max of |/)(\d+) players online:(.*)`)
+
+// formattingCodes matches Minecraft section-sign formatting codes.
+var formattingCodes = regexp.MustCompile(`§.`)
+
+// List runs the list command and parses the online players.
+func (c *Client) List(ctx context.Context) (PlayerList, error) {
+	resp, err := c.Execute(ctx, "list")
+	if err != nil {
+		return PlayerList{}, err
+	}
+	return ParseList(resp)
+}
+
+// ParseList parses the response of the list command.
+func ParseList(resp string) (PlayerList, error) {
+	m := listPattern.FindStringSubmatch(formattingCodes.ReplaceAllString(resp, ""))
+	if m == nil {
+		return PlayerList{}, fmt.Errorf("rcon: unexpected list response %q", resp)
+	}
+
+	online, _ := strconv.Atoi(m[1])
+	maxPlayers, _ := strconv.Atoi(m[2])
+	list := PlayerList{Online: online, Max: maxPlayers}
+	for _, name := range strings.Split(m[3], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			list.Names = append(list.Names, name)
+		}
+	}
+	return list, nil
+}
+
+// SaveAll flushes all chunks to disk.
+func (c *Client) SaveAll(ctx context.Context) error {
+	_, err := c.Execute(ctx, "save-all flush")
+	return err
+}
+
+// Say broadcasts message to all players.
+func (c *Client) Say(ctx context.Context, message string) error {
+	_, err := c.Execute(ctx, "say "+message)
+	return err
+}
+
+// WhitelistAdd adds player to the whitelist.
+func (c *Client) WhitelistAdd(ctx context.Context, player string) error {
+	_, err := c.Execute(ctx, "whitelist add "+player)
+	return err
+}
+
+// Stop asks the server to save and shut down. The server usually closes the
+// connection before answering, so connection errors are not reported.
+func (c *Client) Stop(ctx context.Context) error {
+	_, err := c.Execute(ctx, "stop")
+	if err != nil && !isConnError(err) {
+		return err
+	}
+	return nil
+}
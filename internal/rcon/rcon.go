@@ -0,0 +1,270 @@
+// Package rcon implements a client for the Source RCON protocol as spoken by
+// Minecraft Java Edition servers.
+package rcon
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Packet types as defined by the Source RCON protocol.
+const (
+	typeResponseValue = 0
+	typeExecCommand   = 2
+	typeAuthResponse  = 2
+	typeAuth          = 3
+)
+
+const (
+	// headerSize is the size of the ID and type fields plus the two trailing null bytes.
+	headerSize = 10
+	// maxCommandLength is the longest command Minecraft accepts in a single packet.
+	maxCommandLength = 1446
+	// maxPacketSize guards against garbage lengths; Minecraft responses are at most 4096 bytes of body.
+	maxPacketSize = 4096 + headerSize
+
+	defaultTimeout = 10 * time.Second
+)
+
+var (
+	// ErrAuthFailed is returned when the server rejects the password.
+	ErrAuthFailed = errors.New("rcon: authentication failed")
+	// ErrCommandTooLong is returned for commands exceeding maxCommandLength.
+	ErrCommandTooLong = errors.New("rcon: command too long")
+	// ErrInvalidPacket is returned when a packet cannot be decoded.
+	ErrInvalidPacket = errors.New("rcon: invalid packet")
+	// ErrClosed is returned when using a client after Close.
+	ErrClosed = errors.New("rcon: client closed")
+)
+
+type packet struct {
+	ID   int32
+	Type int32
+	Body string
+}
+
+// Client is an authenticated RCON connection. It is safe for concurrent use and
+// transparently reconnects once if a command cannot be sent due to a broken
+// connection. A command that reached the server is never re-sent, so commands
+// that are not idempotent do not run twice.
+type Client struct {
+	addr     string
+	password string
+	timeout  time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	nextID int32
+	closed bool
+}
+
+// Dial connects to addr and authenticates with password.
+func Dial(ctx context.Context, addr, password string) (*Client, error) {
+	c := &Client{
+		addr:     addr,
+		password: password,
+		timeout:  defaultTimeout,
+	}
+	if err := c.connect(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Execute runs command on the server and returns its full, possibly multi-packet, response.
+func (c *Client) Execute(ctx context.Context, command string) (string, error) {
+	if len(command) > maxCommandLength {
+		return "", ErrCommandTooLong
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return "", ErrClosed
+	}
+
+	cmdID, termID, err := c.send(ctx, command)
+	if err != nil && isConnError(err) {
+		// The command never reached the server; reconnect once and resend.
+		c.reset()
+		if err := c.connect(ctx); err != nil {
+			return "", err
+		}
+		cmdID, termID, err = c.send(ctx, command)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.receive(cmdID, termID)
+	if err != nil && isConnError(err) {
+		// The command may have run; drop the connection so the next command
+		// reconnects instead of retrying this one.
+		c.reset()
+	}
+	return resp, err
+}
+
+// Close closes the underlying connection.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// connect dials and authenticates. The caller must hold c.mu or own c exclusively.
+func (c *Client) connect(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return fmt.Errorf("rcon: dial: %w", err)
+	}
+	c.conn = conn
+
+	id := c.id()
+	if err := c.setDeadline(ctx); err != nil {
+		c.reset()
+		return err
+	}
+	if err := writePacket(conn, packet{ID: id, Type: typeAuth, Body: c.password}); err != nil {
+		c.reset()
+		return fmt.Errorf("rcon: write auth: %w", err)
+	}
+
+	// Some servers send an empty response value before the auth response.
+	for {
+		p, err := readPacket(conn)
+		if err != nil {
+			c.reset()
+			return fmt.Errorf("rcon: read auth response: %w", err)
+		}
+		if p.Type != typeAuthResponse {
+			continue
+		}
+		if p.ID == -1 || p.ID != id {
+			c.reset()
+			return ErrAuthFailed
+		}
+		return nil
+	}
+}
+
+// send writes command and returns its packet ID along with the ID of the
+// empty terminator packet receive sends after it. An error means the command
+// packet could not be written.
+func (c *Client) send(ctx context.Context, command string) (cmdID, termID int32, err error) {
+	if c.conn == nil {
+		return 0, 0, &net.OpError{Op: "write", Err: net.ErrClosed}
+	}
+	if err := c.setDeadline(ctx); err != nil {
+		return 0, 0, err
+	}
+
+	cmdID = c.id()
+	termID = c.id()
+	if err := writePacket(c.conn, packet{ID: cmdID, Type: typeExecCommand, Body: command}); err != nil {
+		return 0, 0, fmt.Errorf("rcon: write command: %w", err)
+	}
+	return cmdID, termID, nil
+}
+
+// receive writes the terminator and collects the command's response. The
+// server answers packets in order, so every response up to the terminator's
+// reply belongs to the command. Errors here may follow a command that already
+// ran, so they are never retried.
+func (c *Client) receive(cmdID, termID int32) (string, error) {
+	if err := writePacket(c.conn, packet{ID: termID, Type: typeResponseValue}); err != nil {
+		return "", fmt.Errorf("rcon: write terminator: %w", err)
+	}
+
+	var resp bytes.Buffer
+	for {
+		p, err := readPacket(c.conn)
+		if err != nil {
+			return "", fmt.Errorf("rcon: read response: %w", err)
+		}
+		switch p.ID {
+		case cmdID:
+			resp.WriteString(p.Body)
+		case termID:
+			return resp.String(), nil
+		}
+	}
+}
+
+func (c *Client) setDeadline(ctx context.Context) error {
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	return c.conn.SetDeadline(deadline)
+}
+
+func (c *Client) reset() {
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+}
+
+func (c *Client) id() int32 {
+	c.nextID++
+	if c.nextID <= 0 {
+		c.nextID = 1
+	}
+	return c.nextID
+}
+
+func isConnError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed)
+}
+
+// writePacket encodes p as little-endian size, ID, type, body and two null bytes.
+func writePacket(w io.Writer, p packet) error {
+	buf := make([]byte, 4, 4+headerSize+len(p.Body))
+	binary.LittleEndian.PutUint32(buf, uint32(headerSize+len(p.Body)))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(p.ID))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(p.Type))
+	buf = append(buf, p.Body...)
+	buf = append(buf, 0, 0)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readPacket decodes a single packet from r.
+func readPacket(r io.Reader) (packet, error) {
+	var size int32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return packet{}, err
+	}
+	if size < headerSize || size > maxPacketSize {
+		return packet{}, fmt.Errorf("%w: size %d", ErrInvalidPacket, size)
+	}
+
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return packet{}, err
+	}
+
+	return packet{
+		ID:   int32(binary.LittleEndian.Uint32(buf[0:4])),
+		Type: int32(binary.LittleEndian.Uint32(buf[4:8])),
+		Body: string(bytes.TrimRight(buf[8:], "\x00")),
+	}, nil
+}
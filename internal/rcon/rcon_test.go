@@ -0,0 +1,165 @@
+package rcon
+
+import (
+	"context"
+	"net"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeServer accepts RCON connections, authenticates any password and hands
+// every command to handle. handle returns false to drop the connection
+// without answering.
+type fakeServer struct {
+	ln       net.Listener
+	conns    atomic.Int32
+	commands atomic.Int32
+}
+
+func newFakeServer(t *testing.T, handle func(n int32, command string) bool) *fakeServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{ln: ln}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.conns.Add(1)
+			go s.serve(conn, handle)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(conn net.Conn, handle func(n int32, command string) bool) {
+	// nolint: errcheck
+	defer conn.Close()
+	for {
+		p, err := readPacket(conn)
+		if err != nil {
+			return
+		}
+		switch p.Type {
+		case typeAuth:
+			if writePacket(conn, packet{ID: p.ID, Type: typeAuthResponse}) != nil {
+				return
+			}
+		case typeExecCommand:
+			if !handle(s.commands.Add(1), p.Body) {
+				return
+			}
+			if writePacket(conn, packet{ID: p.ID, Type: typeResponseValue, Body: "ok " + p.Body}) != nil {
+				return
+			}
+		case typeResponseValue:
+			if writePacket(conn, packet{ID: p.ID, Type: typeResponseValue}) != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	s := newFakeServer(t, func(int32, string) bool { return true })
+	c, err := Dial(context.Background(), s.ln.Addr().String(), "secret")
+	if err != nil {
+		t.Fatalf("Dial(): %v", err)
+	}
+	// nolint: errcheck
+	defer c.Close()
+
+	resp, err := c.Execute(context.Background(), "list")
+	if err != nil {
+		t.Fatalf("Execute(): %v", err)
+	}
+	if resp != "ok list" {
+		t.Fatalf("Execute() = %q, want %q", resp, "ok list")
+	}
+}
+
+func TestExecuteDoesNotResendAfterSend(t *testing.T) {
+	// The first command reaches the server, which then drops the connection
+	// before answering, as a crash or stop would.
+	s := newFakeServer(t, func(n int32, _ string) bool { return n > 1 })
+	c, err := Dial(context.Background(), s.ln.Addr().String(), "secret")
+	if err != nil {
+		t.Fatalf("Dial(): %v", err)
+	}
+	// nolint: errcheck
+	defer c.Close()
+
+	if _, err := c.Execute(context.Background(), "say hello"); err == nil {
+		t.Fatal("Execute() succeeded on a dropped connection, want an error")
+	}
+	if got := s.commands.Load(); got != 1 {
+		t.Fatalf("server received %d commands, want 1", got)
+	}
+
+	// The next command reconnects.
+	resp, err := c.Execute(context.Background(), "list")
+	if err != nil {
+		t.Fatalf("Execute() after a dropped connection: %v", err)
+	}
+	if resp != "ok list" {
+		t.Fatalf("Execute() = %q, want %q", resp, "ok list")
+	}
+	if got := s.conns.Load(); got != 2 {
+		t.Fatalf("server accepted %d connections, want 2", got)
+	}
+}
+
+func TestExecuteReconnectsBeforeSend(t *testing.T) {
+	s := newFakeServer(t, func(int32, string) bool { return true })
+	c, err := Dial(context.Background(), s.ln.Addr().String(), "secret")
+	if err != nil {
+		t.Fatalf("Dial(): %v", err)
+	}
+	// nolint: errcheck
+	defer c.Close()
+
+	// Break the connection locally so the command cannot be written.
+	_ = c.conn.Close()
+
+	resp, err := c.Execute(context.Background(), "list")
+	if err != nil {
+		t.Fatalf("Execute(): %v", err)
+	}
+	if resp != "ok list" {
+		t.Fatalf("Execute() = %q, want %q", resp, "ok list")
+	}
+	if got := s.commands.Load(); got != 1 {
+		t.Fatalf("server received %d commands, want 1", got)
+	}
+}
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		resp string
+		want PlayerList
+	}{
+		{"There are 0 of a max of 20 players online: ", PlayerList{Max: 20}},
+		{"There are 2 of a max of 20 players online: Steve, Alex", PlayerList{Online: 2, Max: 20, Names: []string{"Steve", "Alex"}}},
+		{"There are 1/10 players online:§aSteve", PlayerList{Online: 1, Max: 10, Names: []string{"Steve"}}},
+	}
+	for _, tt := range tests {
+		got, err := ParseList(tt.resp)
+		if err != nil {
+			t.Errorf("ParseList(%q): %v", tt.resp, err)
+			continue
+		}
+		if got.Online != tt.want.Online || got.Max != tt.want.Max || !slices.Equal(got.Names, tt.want.Names) {
+			t.Errorf("ParseList(%q) = %+v, want %+v", tt.resp, got, tt.want)
+		}
+	}
+	if _, err := ParseList("Unknown command"); err == nil {
+		t.Error("ParseList() of an unknown response succeeded, want an error")
+	}
+}
@@ -0,0 +1,55 @@
+package resolvers
+
+import "strings"
+
+// edgeCountries maps the airport codes AWS names its edge locations after to
+// ISO 3166 country codes. Locations missing here can still be allowed by
+// their airport code.
+var edgeCountries = map[string]string{
+	// North America
+	"ATL": "US", "BNA": "US", "BOS": "US", "CMH": "US", "DEN": "US", "DFW": "US",
+	"DTW": "US", "EWR": "US", "HIO": "US", "HNL": "US", "IAD": "US", "IAH": "US",
+	"JAX": "US", "JFK": "US", "LAX": "US", "MCI": "US", "MIA": "US", "MSP": "US",
+	"ORD": "US", "PDX": "US", "PHL": "US", "PHX": "US", "PIT": "US", "SEA": "US",
+	"SFO": "US", "SLC": "US",
+	"YUL": "CA", "YTO": "CA", "YVR": "CA",
+	"MEX": "MX", "QRO": "MX",
+	// South America
+	"BOG": "CO", "EZE": "AR", "FOR": "BR", "GIG": "BR", "GRU": "BR", "LIM": "PE",
+	"POA": "BR", "SCL": "CL",
+	// Europe
+	"AMS": "NL", "ARN": "SE", "ATH": "GR", "BCN": "ES", "BRU": "BE", "BUD": "HU",
+	"CDG": "FR", "CPH": "DK", "DUB": "IE", "DUS": "DE", "FCO": "IT", "FRA": "DE",
+	"HAM": "DE", "HEL": "FI", "LHR": "GB", "LIS": "PT", "MAD": "ES", "MAN": "GB",
+	"MRS": "FR", "MUC": "DE", "MXP": "IT", "OSL": "NO", "OTP": "RO", "PMO": "IT",
+	"PRG": "CZ", "SOF": "BG", "TXL": "DE", "VIE": "AT", "WAW": "PL", "ZAG": "HR",
+	"ZRH": "CH",
+	// Middle East and Africa
+	"BAH": "BH", "CAI": "EG", "CPT": "ZA", "DXB": "AE", "FJR": "AE", "JNB": "ZA",
+	"LOS": "NG", "NBO": "KE", "TLV": "IL",
+	// Asia Pacific
+	"AKL": "NZ", "BKK": "TH", "BLR": "IN", "BNE": "AU", "BOM": "IN", "CCU": "IN",
+	"CGK": "ID", "DEL": "IN", "HAN": "VN", "HKG": "HK", "HYD": "IN", "ICN": "KR",
+	"KIX": "JP", "KUL": "MY", "MAA": "IN", "MEL": "AU", "MNL": "PH", "NRT": "JP",
+	"PER": "AU", "SGN": "VN", "SIN": "SG", "SYD": "AU", "TPE": "TW",
+}
+
+// EdgeCode returns the airport code of an edge location, e.g. "FRA" for
+// "FRA56-P1".
+func EdgeCode(edgeLocation string) string {
+	end := 0
+	for end < len(edgeLocation) && end < 3 && isLetter(edgeLocation[end]) {
+		end++
+	}
+	return strings.ToUpper(edgeLocation[:end])
+}
+
+// EdgeCountry returns the ISO 3166 country code of an airport code, or an
+// empty string if it is unknown.
+func EdgeCountry(code string) string {
+	return edgeCountries[code]
+}
+
+func isLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
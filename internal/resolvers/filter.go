@@ -0,0 +1,99 @@
+// Package resolvers decides which DNS resolvers may wake the server and
+// remembers resolvers whose queries led to real player sessions.
+package resolvers
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Reasons a query is rejected.
+const (
+	ReasonDenied     = "denied_resolver"
+	ReasonNotAllowed = "resolver_not_allowed"
+)
+
+// Filter holds the static resolver rules of the launcher.
+//
+// A resolver in Deny is always rejected. Otherwise, if no allow rule is
+// configured every resolver is accepted. If any is, the query must match at
+// least one of them: a resolver in Allow or an edge location or country in
+// Edges. Callers may still accept queries rejected with ReasonNotAllowed if
+// the resolver was learned.
+type Filter struct {
+	Allow []netip.Prefix
+	Deny  []netip.Prefix
+	// Edges holds upper-case IATA airport codes, e.g. "FRA", and ISO 3166
+	// country codes, e.g. "DE", of allowed Route53 edge locations.
+	Edges map[string]bool
+}
+
+// NewFilter parses the CIDR lists and edge location allowlist.
+func NewFilter(allow, deny, edges []string) (*Filter, error) {
+	f := &Filter{Edges: make(map[string]bool, len(edges))}
+	var err error
+	if f.Allow, err = parsePrefixes(allow); err != nil {
+		return nil, err
+	}
+	if f.Deny, err = parsePrefixes(deny); err != nil {
+		return nil, err
+	}
+	for _, edge := range edges {
+		edge = strings.ToUpper(strings.TrimSpace(edge))
+		switch len(edge) {
+		case 0:
+		case 2, 3:
+			f.Edges[edge] = true
+		default:
+			return nil, fmt.Errorf("invalid edge location %q, want an IATA airport code or ISO country code", edge)
+		}
+	}
+	return f, nil
+}
+
+// HasAllowRules reports whether the filter restricts which resolvers may wake
+// the server.
+func (f *Filter) HasAllowRules() bool {
+	return len(f.Allow) > 0 || len(f.Edges) > 0
+}
+
+// Decide reports whether a query from resolver via edgeLocation may wake the
+// server. If the query is rejected, reason says why.
+func (f *Filter) Decide(resolver netip.Addr, edgeLocation string) (ok bool, reason string) {
+	if contains(f.Deny, resolver) {
+		return false, ReasonDenied
+	}
+	if !f.HasAllowRules() || contains(f.Allow, resolver) {
+		return true, ""
+	}
+	code := EdgeCode(edgeLocation)
+	if f.Edges[code] || f.Edges[EdgeCountry(code)] {
+		return true, ""
+	}
+	return false, ReasonNotAllowed
+}
+
+func parsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
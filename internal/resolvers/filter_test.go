@@ -0,0 +1,195 @@
+package resolvers
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestFilterDecide(t *testing.T) {
+	tests := []struct {
+		name       string
+		allow      []string
+		deny       []string
+		edges      []string
+		resolver   string
+		edge       string
+		wantOK     bool
+		wantReason string
+	}{
+		{
+			name:     "no rules accepts everything",
+			resolver: "198.51.100.7",
+			edge:     "IAD89-C1",
+			wantOK:   true,
+		},
+		{
+			name:       "deny without allow rules",
+			deny:       []string{"198.51.100.0/24"},
+			resolver:   "198.51.100.7",
+			edge:       "FRA56-P1",
+			wantReason: ReasonDenied,
+		},
+		{
+			name:       "deny overrides allow",
+			allow:      []string{"198.51.100.0/24"},
+			deny:       []string{"198.51.100.7/32"},
+			edges:      []string{"FRA"},
+			resolver:   "198.51.100.7",
+			edge:       "FRA56-P1",
+			wantReason: ReasonDenied,
+		},
+		{
+			name:     "allowed by ipv4 CIDR",
+			allow:    []string{"198.51.100.0/24"},
+			resolver: "198.51.100.7",
+			edge:     "IAD89-C1",
+			wantOK:   true,
+		},
+		{
+			name:     "allowed by ipv6 CIDR",
+			allow:    []string{"2001:db8::/32"},
+			resolver: "2001:db8:1::53",
+			edge:     "IAD89-C1",
+			wantOK:   true,
+		},
+		{
+			name:       "outside the allowed CIDRs",
+			allow:      []string{"198.51.100.0/24", "2001:db8::/32"},
+			resolver:   "203.0.113.1",
+			edge:       "IAD89-C1",
+			wantReason: ReasonNotAllowed,
+		},
+		{
+			name:     "allowed by airport code",
+			edges:    []string{"FRA"},
+			resolver: "203.0.113.1",
+			edge:     "FRA56-P1",
+			wantOK:   true,
+		},
+		{
+			name:     "allowed by country",
+			edges:    []string{"de"},
+			resolver: "203.0.113.1",
+			edge:     "FRA56-P1",
+			wantOK:   true,
+		},
+		{
+			name:       "other country",
+			edges:      []string{"FR", "MUC"},
+			resolver:   "203.0.113.1",
+			edge:       "FRA56-P1",
+			wantReason: ReasonNotAllowed,
+		},
+		{
+			name:       "unknown edge",
+			edges:      []string{"DE"},
+			resolver:   "203.0.113.1",
+			edge:       "XYZ1",
+			wantReason: ReasonNotAllowed,
+		},
+		{
+			name:       "missing edge",
+			edges:      []string{"DE"},
+			resolver:   "203.0.113.1",
+			edge:       "",
+			wantReason: ReasonNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFilter(tt.allow, tt.deny, tt.edges)
+			if err != nil {
+				t.Fatalf("NewFilter(): %v", err)
+			}
+			ok, reason := f.Decide(netip.MustParseAddr(tt.resolver), tt.edge)
+			if ok != tt.wantOK || reason != tt.wantReason {
+				t.Fatalf("Decide(%s, %q) = %t, %q, want %t, %q", tt.resolver, tt.edge, ok, reason, tt.wantOK, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestNewFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		allow     []string
+		deny      []string
+		edges     []string
+		wantAllow int
+		wantEdges []string
+		wantErr   bool
+	}{
+		{
+			name:      "blank entries are skipped",
+			allow:     []string{" 198.51.100.0/24 ", ""},
+			edges:     []string{" fra ", "", "de"},
+			wantAllow: 1,
+			wantEdges: []string{"FRA", "DE"},
+		},
+		{name: "bad allow CIDR", allow: []string{"198.51.100.0/33"}, wantErr: true},
+		{name: "bad deny CIDR", deny: []string{"not-a-cidr"}, wantErr: true},
+		{name: "address without prefix length", allow: []string{"198.51.100.7"}, wantErr: true},
+		{name: "one letter edge", edges: []string{"F"}, wantErr: true},
+		{name: "four letter edge", edges: []string{"FRA5"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFilter(tt.allow, tt.deny, tt.edges)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("NewFilter() = %+v, want an error", f)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewFilter(): %v", err)
+			}
+			if len(f.Allow) != tt.wantAllow {
+				t.Errorf("Allow = %v, want %d prefixes", f.Allow, tt.wantAllow)
+			}
+			if len(f.Edges) != len(tt.wantEdges) {
+				t.Errorf("Edges = %v, want %v", f.Edges, tt.wantEdges)
+			}
+			for _, edge := range tt.wantEdges {
+				if !f.Edges[edge] {
+					t.Errorf("Edges = %v, want %s", f.Edges, edge)
+				}
+			}
+		})
+	}
+}
+
+func TestNewFilterMasksPrefixes(t *testing.T) {
+	f, err := NewFilter([]string{"198.51.100.7/24"}, nil, nil)
+	if err != nil {
+		t.Fatalf("NewFilter(): %v", err)
+	}
+	if got, want := f.Allow[0], netip.MustParsePrefix("198.51.100.0/24"); got != want {
+		t.Fatalf("Allow[0] = %s, want %s", got, want)
+	}
+}
+
+func TestEdgeCode(t *testing.T) {
+	tests := []struct {
+		edge        string
+		wantCode    string
+		wantCountry string
+	}{
+		{"FRA56-P1", "FRA", "DE"},
+		{"fra6", "FRA", "DE"},
+		{"IAD89-C1", "IAD", "US"},
+		{"NRT57-P2", "NRT", "JP"},
+		{"XYZ1", "XYZ", ""},
+		{"F1", "F", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		code := EdgeCode(tt.edge)
+		if code != tt.wantCode {
+			t.Errorf("EdgeCode(%q) = %q, want %q", tt.edge, code, tt.wantCode)
+		}
+		if country := EdgeCountry(code); country != tt.wantCountry {
+			t.Errorf("EdgeCountry(%q) = %q, want %q", code, country, tt.wantCountry)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package resolvers
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// lastWakeKey is the item recording the resolver of the most recent wakeup.
+// It cannot collide with a resolver, as it is not an IP address.
+const lastWakeKey = "#last-wake"
+
+// DynamoDBAPI is the subset of the DynamoDB client used by Store.
+type DynamoDBAPI interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+}
+
+// Store keeps learned resolvers in a table keyed by resolver (partition key).
+// Learned resolvers expire through the table's expires_at TTL attribute.
+//
+// The launcher records the resolver of every wakeup with RecordWake. Once a
+// player joins, the watchdog calls LearnLastWake to remember that resolver.
+type Store struct {
+	Client DynamoDBAPI
+	Table  string
+	// TTL is how long a learned resolver is remembered.
+	TTL time.Duration
+	// Service scopes the last wakeup to one ECS service, so servers sharing
+	// the table only learn the resolvers of their own wakeups.
+	Service string
+}
+
+// lastWakeKey returns the key of the last wakeup of the service.
+func (s *Store) lastWakeKey() string {
+	if s.Service == "" {
+		return lastWakeKey
+	}
+	return lastWakeKey + "/" + s.Service
+}
+
+// RecordWake remembers resolver as the cause of a wakeup at t.
+func (s *Store) RecordWake(ctx context.Context, resolver netip.Addr, t time.Time) error {
+	_, err := s.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.Table),
+		Item: map[string]types.AttributeValue{
+			"resolver":      &types.AttributeValueMemberS{Value: s.lastWakeKey()},
+			"last_resolver": &types.AttributeValueMemberS{Value: resolver.String()},
+			"woke_at":       &types.AttributeValueMemberS{Value: t.UTC().Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record wakeup in %s: %w", s.Table, err)
+	}
+	return nil
+}
+
+// LearnLastWake learns the resolver of the last wakeup if it happened after
+// since. It returns the learned resolver, or the zero Addr if there was none.
+func (s *Store) LearnLastWake(ctx context.Context, since, now time.Time) (netip.Addr, error) {
+	item, err := s.get(ctx, s.lastWakeKey())
+	if err != nil || item == nil {
+		return netip.Addr{}, err
+	}
+	wokeAt, err := time.Parse(time.RFC3339, stringAttr(item, "woke_at"))
+	if err != nil || wokeAt.Before(since) {
+		return netip.Addr{}, nil
+	}
+	resolver, err := netip.ParseAddr(stringAttr(item, "last_resolver"))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid resolver in last wakeup: %w", err)
+	}
+
+	_, err = s.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.Table),
+		Item: map[string]types.AttributeValue{
+			"resolver":   &types.AttributeValueMemberS{Value: resolver.String()},
+			"learned_at": &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339)},
+			"expires_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(s.TTL).Unix(), 10)},
+		},
+	})
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to learn resolver %s in %s: %w", resolver, s.Table, err)
+	}
+	return resolver, nil
+}
+
+// Learned reports whether resolver led to a player session within the TTL.
+func (s *Store) Learned(ctx context.Context, resolver netip.Addr, now time.Time) (bool, error) {
+	item, err := s.get(ctx, resolver.String())
+	if err != nil || item == nil {
+		return false, err
+	}
+	// DynamoDB deletes expired items lazily, so expiry is checked here too.
+	expiresAt, err := strconv.ParseInt(numberAttr(item, "expires_at"), 10, 64)
+	if err != nil {
+		return false, nil
+	}
+	return now.Unix() < expiresAt, nil
+}
+
+func (s *Store) get(ctx context.Context, key string) (map[string]types.AttributeValue, error) {
+	resp, err := s.Client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.Table),
+		Key: map[string]types.AttributeValue{
+			"resolver": &types.AttributeValueMemberS{Value: key},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from %s: %w", key, s.Table, err)
+	}
+	return resp.Item, nil
+}
+
+func stringAttr(item map[string]types.AttributeValue, name string) string {
+	if v, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+func numberAttr(item map[string]types.AttributeValue, name string) string {
+	if v, ok := item[name].(*types.AttributeValueMemberN); ok {
+		return v.Value
+	}
+	return ""
+}
@@ -0,0 +1,175 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fakeDynamoDB is a single table keyed by the resolver attribute.
+type fakeDynamoDB struct {
+	items  map[string]map[string]types.AttributeValue
+	putErr error
+}
+
+func (f *fakeDynamoDB) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	key := params.Key["resolver"].(*types.AttributeValueMemberS).Value
+	return &dynamodb.GetItemOutput{Item: f.items[key]}, nil
+}
+
+func (f *fakeDynamoDB) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if f.putErr != nil {
+		return nil, f.putErr
+	}
+	if f.items == nil {
+		f.items = make(map[string]map[string]types.AttributeValue)
+	}
+	f.items[params.Item["resolver"].(*types.AttributeValueMemberS).Value] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func newTestStore(service string) (*Store, *fakeDynamoDB) {
+	db := &fakeDynamoDB{}
+	return &Store{Client: db, Table: "resolvers", TTL: 24 * time.Hour, Service: service}, db
+}
+
+var (
+	testWokeAt   = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	testResolver = netip.MustParseAddr("198.51.100.7")
+)
+
+func TestStoreLearnLastWake(t *testing.T) {
+	ctx := context.Background()
+	store, db := newTestStore("minecraft")
+	if err := store.RecordWake(ctx, testResolver, testWokeAt); err != nil {
+		t.Fatalf("RecordWake(): %v", err)
+	}
+
+	// The wakeup is not learned as a resolver before a player joins.
+	if learned, err := store.Learned(ctx, testResolver, testWokeAt); err != nil || learned {
+		t.Fatalf("Learned() before LearnLastWake = %t, %v, want false", learned, err)
+	}
+
+	now := testWokeAt.Add(5 * time.Minute)
+	got, err := store.LearnLastWake(ctx, testWokeAt.Add(-time.Minute), now)
+	if err != nil {
+		t.Fatalf("LearnLastWake(): %v", err)
+	}
+	if got != testResolver {
+		t.Fatalf("LearnLastWake() = %s, want %s", got, testResolver)
+	}
+
+	item := db.items[testResolver.String()]
+	if item == nil {
+		t.Fatalf("resolver %s not stored, items %v", testResolver, db.items)
+	}
+	if got, want := numberAttr(item, "expires_at"), strconv.FormatInt(now.Add(store.TTL).Unix(), 10); got != want {
+		t.Errorf("expires_at = %s, want %s", got, want)
+	}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{"right after learning", now, true},
+		{"just before expiry", now.Add(store.TTL - time.Second), true},
+		{"at expiry", now.Add(store.TTL), false},
+		{"after expiry", now.Add(2 * store.TTL), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			learned, err := store.Learned(ctx, testResolver, tt.now)
+			if err != nil {
+				t.Fatalf("Learned(): %v", err)
+			}
+			if learned != tt.want {
+				t.Fatalf("Learned() = %t, want %t", learned, tt.want)
+			}
+		})
+	}
+
+	if learned, err := store.Learned(ctx, netip.MustParseAddr("203.0.113.1"), now); err != nil || learned {
+		t.Errorf("Learned() of an unknown resolver = %t, %v, want false", learned, err)
+	}
+}
+
+func TestStoreLearnLastWakeSkipsOldWakeups(t *testing.T) {
+	ctx := context.Background()
+	store, db := newTestStore("minecraft")
+	if err := store.RecordWake(ctx, testResolver, testWokeAt); err != nil {
+		t.Fatalf("RecordWake(): %v", err)
+	}
+
+	got, err := store.LearnLastWake(ctx, testWokeAt.Add(time.Minute), testWokeAt.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("LearnLastWake(): %v", err)
+	}
+	if got.IsValid() {
+		t.Fatalf("LearnLastWake() = %s, want no resolver for a wakeup before since", got)
+	}
+	if _, ok := db.items[testResolver.String()]; ok {
+		t.Error("resolver of an old wakeup was learned")
+	}
+}
+
+func TestStoreLearnLastWakeWithoutWakeup(t *testing.T) {
+	store, _ := newTestStore("minecraft")
+	got, err := store.LearnLastWake(context.Background(), testWokeAt, testWokeAt)
+	if err != nil || got.IsValid() {
+		t.Fatalf("LearnLastWake() = %s, %v, want no resolver", got, err)
+	}
+}
+
+func TestStoreLastWakeScopedByService(t *testing.T) {
+	ctx := context.Background()
+	db := &fakeDynamoDB{}
+	java := &Store{Client: db, Table: "resolvers", TTL: time.Hour, Service: "java"}
+	bedrock := &Store{Client: db, Table: "resolvers", TTL: time.Hour, Service: "bedrock"}
+
+	if err := java.RecordWake(ctx, testResolver, testWokeAt); err != nil {
+		t.Fatalf("RecordWake(): %v", err)
+	}
+	if _, ok := db.items["#last-wake/java"]; !ok {
+		t.Fatalf("last wakeup not stored under the service key, items %v", db.items)
+	}
+	got, err := bedrock.LearnLastWake(ctx, testWokeAt.Add(-time.Minute), testWokeAt)
+	if err != nil || got.IsValid() {
+		t.Fatalf("LearnLastWake() of another service = %s, %v, want no resolver", got, err)
+	}
+}
+
+func TestStoreErrors(t *testing.T) {
+	ctx := context.Background()
+	store, db := newTestStore("")
+	db.items = map[string]map[string]types.AttributeValue{
+		lastWakeKey: {
+			"resolver":      &types.AttributeValueMemberS{Value: lastWakeKey},
+			"last_resolver": &types.AttributeValueMemberS{Value: "not-an-ip"},
+			"woke_at":       &types.AttributeValueMemberS{Value: testWokeAt.Format(time.RFC3339)},
+		},
+	}
+	if _, err := store.LearnLastWake(ctx, testWokeAt, testWokeAt); err == nil {
+		t.Error("LearnLastWake() of an invalid resolver succeeded, want an error")
+	}
+
+	db.putErr = errors.New("throttled")
+	if err := store.RecordWake(ctx, testResolver, testWokeAt); err == nil {
+		t.Error("RecordWake() succeeded although PutItem failed")
+	}
+
+	// Items without a TTL attribute are not treated as learned.
+	db.items[testResolver.String()] = map[string]types.AttributeValue{
+		"resolver": &types.AttributeValueMemberS{Value: testResolver.String()},
+		"note":     &types.AttributeValueMemberS{Value: "manual"},
+	}
+	if learned, err := store.Learned(ctx, testResolver, testWokeAt); err != nil || learned {
+		t.Errorf("Learned() without expires_at = %t, %v, want false", learned, err)
+	}
+}
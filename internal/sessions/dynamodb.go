@@ -0,0 +1,42 @@
+package sessions
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DynamoDBAPI is the subset of the DynamoDB client used by DynamoDBStore.
+type DynamoDBAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+}
+
+// DynamoDBStore writes sessions to a table keyed by player (partition key)
+// and joined_at (sort key).
+type DynamoDBStore struct {
+	Client DynamoDBAPI
+	Table  string
+}
+
+// Append stores session as a single item.
+func (s *DynamoDBStore) Append(ctx context.Context, session Session) error {
+	_, err := s.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.Table),
+		Item: map[string]types.AttributeValue{
+			"player":           &types.AttributeValueMemberS{Value: session.Player},
+			"joined_at":        &types.AttributeValueMemberS{Value: session.JoinedAt.UTC().Format(time.RFC3339)},
+			"left_at":          &types.AttributeValueMemberS{Value: session.LeftAt.UTC().Format(time.RFC3339)},
+			"duration_seconds": &types.AttributeValueMemberN{Value: strconv.FormatInt(int64(session.DurationSeconds), 10)},
+			"server":           &types.AttributeValueMemberS{Value: session.Server},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store session in %s: %w", s.Table, err)
+	}
+	return nil
+}
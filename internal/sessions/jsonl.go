@@ -0,0 +1,51 @@
+package sessions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// JSONLStore appends sessions as JSON lines to a file, typically on the EFS
+// volume shared with the server so the history survives the task.
+type JSONLStore struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// NewJSONLStore returns a JSONLStore writing to path.
+func NewJSONLStore(path string) *JSONLStore {
+	return &JSONLStore{Path: path}
+}
+
+// Append writes session as a single line.
+func (s *JSONLStore) Append(_ context.Context, session Session) error {
+	line, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return fmt.Errorf("failed to create session journal directory: %w", err)
+	}
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open session journal: %w", err)
+	}
+
+	// nolint: errcheck
+	defer f.Close()
+
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("failed to write session journal: %w", err)
+	}
+	return nil
+}
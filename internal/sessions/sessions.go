@@ -0,0 +1,162 @@
+// Package sessions tracks player sessions from successive player lists and
+// persists completed sessions.
+package sessions
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Session is a single continuous stay of a player on the server.
+type Session struct {
+	Server          string    `json:"server"`
+	Player          string    `json:"player"`
+	JoinedAt        time.Time `json:"joined_at"`
+	LeftAt          time.Time `json:"left_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+}
+
+// Duration returns the length of the session.
+func (s Session) Duration() time.Duration {
+	return s.LeftAt.Sub(s.JoinedAt)
+}
+
+// Store persists completed sessions.
+type Store interface {
+	Append(ctx context.Context, session Session) error
+}
+
+// Tracker derives sessions from the names of the players online. It is safe
+// for concurrent use.
+type Tracker struct {
+	server string
+
+	mu        sync.Mutex
+	active    map[string]time.Time
+	completed []Session
+	lastLeft  string
+}
+
+// NewTracker returns a Tracker attributing sessions to server.
+func NewTracker(server string) *Tracker {
+	return &Tracker{server: server, active: map[string]time.Time{}}
+}
+
+// Update records the players online at now. It returns the players who
+// joined and the sessions of the players who left since the last update.
+func (t *Tracker) Update(names []string, now time.Time) (joined []string, ended []Session) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	online := make(map[string]bool, len(names))
+	for _, name := range names {
+		online[name] = true
+		if _, ok := t.active[name]; !ok {
+			t.active[name] = now
+			joined = append(joined, name)
+		}
+	}
+	for _, name := range t.sortedActive() {
+		if !online[name] {
+			ended = append(ended, t.end(name, now))
+		}
+	}
+	return joined, ended
+}
+
+// EndAll ends the sessions of all players still online at now.
+func (t *Tracker) EndAll(now time.Time) []Session {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var ended []Session
+	for _, name := range t.sortedActive() {
+		ended = append(ended, t.end(name, now))
+	}
+	return ended
+}
+
+// Summary returns all completed sessions and the player who left last.
+func (t *Tracker) Summary() Summary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Summary{Sessions: slices.Clone(t.completed), LastToLeave: t.lastLeft}
+}
+
+func (t *Tracker) end(name string, now time.Time) Session {
+	session := Session{
+		Server:          t.server,
+		Player:          name,
+		JoinedAt:        t.active[name],
+		LeftAt:          now,
+		DurationSeconds: now.Sub(t.active[name]).Seconds(),
+	}
+	delete(t.active, name)
+	t.completed = append(t.completed, session)
+	t.lastLeft = name
+	return session
+}
+
+func (t *Tracker) sortedActive() []string {
+	names := make([]string, 0, len(t.active))
+	for name := range t.active {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Summary describes the sessions of a server run.
+type Summary struct {
+	Sessions    []Session
+	LastToLeave string
+}
+
+// PlayerTotal is the combined playtime of one player.
+type PlayerTotal struct {
+	Player   string
+	Sessions int
+	Duration time.Duration
+}
+
+// Totals returns the playtime per player, longest first.
+func (s Summary) Totals() []PlayerTotal {
+	byPlayer := map[string]*PlayerTotal{}
+	var totals []*PlayerTotal
+	for _, session := range s.Sessions {
+		total, ok := byPlayer[session.Player]
+		if !ok {
+			total = &PlayerTotal{Player: session.Player}
+			byPlayer[session.Player] = total
+			totals = append(totals, total)
+		}
+		total.Sessions++
+		total.Duration += session.Duration()
+	}
+
+	result := make([]PlayerTotal, 0, len(totals))
+	for _, total := range totals {
+		result = append(result, *total)
+	}
+	slices.SortStableFunc(result, func(a, b PlayerTotal) int {
+		return cmp.Compare(b.Duration, a.Duration)
+	})
+	return result
+}
+
+// FormatDuration formats d as e.g. "1h05m", "12m" or "<1m".
+func FormatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	switch {
+	case d < time.Minute:
+		return "<1m"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%dh%02dm", d/time.Hour, (d%time.Hour)/time.Minute)
+	}
+}
@@ -0,0 +1,246 @@
+// Package slp implements the client side of the Minecraft Java Edition
+// Server List Ping protocol.
+package slp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	// protocolVersion is sent in the handshake. -1 is accepted by vanilla and
+	// most proxies for status requests regardless of the server version.
+	protocolVersion = -1
+	nextStateStatus = 1
+
+	packetIDHandshake = 0x00
+	packetIDStatus    = 0x00
+
+	maxVarIntBytes = 5
+	maxPacketSize  = 2 * 1024 * 1024
+
+	defaultTimeout = 5 * time.Second
+)
+
+var (
+	// ErrVarIntTooBig is returned when a VarInt exceeds five bytes.
+	ErrVarIntTooBig = errors.New("slp: varint too big")
+	// ErrUnexpectedPacket is returned when the server answers with an unexpected packet ID.
+	ErrUnexpectedPacket = errors.New("slp: unexpected packet id")
+	// ErrPacketTooLarge is returned when a packet length exceeds maxPacketSize.
+	ErrPacketTooLarge = errors.New("slp: packet too large")
+	// ErrEmptyPacket is returned when a packet length is zero or negative, a
+	// packet holds at least its ID.
+	ErrEmptyPacket = errors.New("slp: empty packet")
+)
+
+// Status is the JSON document returned by a server in response to a status request.
+type Status struct {
+	Version     Version         `json:"version"`
+	Players     Players         `json:"players"`
+	Description json.RawMessage `json:"description,omitempty"`
+	Favicon     string          `json:"favicon,omitempty"`
+}
+
+// Version describes the server version and protocol number.
+type Version struct {
+	Name     string `json:"name"`
+	Protocol int    `json:"protocol"`
+}
+
+// Players holds the player counts and the optional player sample.
+type Players struct {
+	Max    int      `json:"max"`
+	Online int      `json:"online"`
+	Sample []Player `json:"sample,omitempty"`
+}
+
+// Player is a single entry of the player sample.
+type Player struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+}
+
+// anonymousID is used by servers that hide player names from the sample.
+const anonymousID = "00000000-0000-0000-0000-000000000000"
+
+// Names returns the names of all non-anonymous players in the sample.
+func (p Players) Names() []string {
+	names := make([]string, 0, len(p.Sample))
+	for _, player := range p.Sample {
+		if player.ID == anonymousID || player.Name == "" {
+			continue
+		}
+		names = append(names, player.Name)
+	}
+	return names
+}
+
+// Ping performs a Server List Ping against addr (host:port) and returns the decoded status.
+// If ctx has no deadline, a default timeout of five seconds is applied.
+func Ping(ctx context.Context, addr string) (*Status, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("slp: invalid address %q: %w", addr, err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("slp: invalid port %q: %w", portStr, err)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultTimeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("slp: dial: %w", err)
+	}
+
+	// nolint: errcheck
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	return exchange(conn, host, uint16(port))
+}
+
+// exchange writes the handshake and status request to rw and decodes the response.
+func exchange(rw io.ReadWriter, host string, port uint16) (*Status, error) {
+	if _, err := rw.Write(buildHandshake(host, port)); err != nil {
+		return nil, fmt.Errorf("slp: write handshake: %w", err)
+	}
+	if _, err := rw.Write(buildPacket(packetIDStatus, nil)); err != nil {
+		return nil, fmt.Errorf("slp: write status request: %w", err)
+	}
+
+	payload, err := readPacket(bufio.NewReader(rw), packetIDStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	r := bytes.NewReader(payload)
+	raw, err := ReadString(r)
+	if err != nil {
+		return nil, fmt.Errorf("slp: read status json: %w", err)
+	}
+
+	var status Status
+	if err := json.Unmarshal([]byte(raw), &status); err != nil {
+		return nil, fmt.Errorf("slp: decode status json: %w", err)
+	}
+	return &status, nil
+}
+
+// buildHandshake returns a framed handshake packet with next state set to status.
+func buildHandshake(host string, port uint16) []byte {
+	var body bytes.Buffer
+	body.Write(AppendVarInt(nil, protocolVersion))
+	body.Write(AppendString(nil, host))
+	_ = binary.Write(&body, binary.BigEndian, port)
+	body.Write(AppendVarInt(nil, nextStateStatus))
+	return buildPacket(packetIDHandshake, body.Bytes())
+}
+
+// buildPacket frames a packet as VarInt(length) VarInt(id) payload.
+func buildPacket(id int32, payload []byte) []byte {
+	body := AppendVarInt(nil, id)
+	body = append(body, payload...)
+	packet := AppendVarInt(nil, int32(len(body)))
+	return append(packet, body...)
+}
+
+// readPacket reads one framed packet and verifies its ID, returning the payload.
+func readPacket(r io.ByteReader, wantID int32) ([]byte, error) {
+	length, err := ReadVarInt(r)
+	if err != nil {
+		return nil, fmt.Errorf("slp: read packet length: %w", err)
+	}
+	if length <= 0 {
+		return nil, fmt.Errorf("%w: %d bytes", ErrEmptyPacket, length)
+	}
+	if length > maxPacketSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrPacketTooLarge, length)
+	}
+
+	packet := make([]byte, length)
+	for i := range packet {
+		if packet[i], err = r.ReadByte(); err != nil {
+			return nil, fmt.Errorf("slp: read packet body: %w", err)
+		}
+	}
+
+	br := bytes.NewReader(packet)
+	id, err := ReadVarInt(br)
+	if err != nil {
+		return nil, fmt.Errorf("slp: read packet id: %w", err)
+	}
+	if id != wantID {
+		return nil, fmt.Errorf("%w: got 0x%02x, want 0x%02x", ErrUnexpectedPacket, id, wantID)
+	}
+	return packet[len(packet)-br.Len():], nil
+}
+
+// AppendVarInt appends the VarInt encoding of v to buf.
+func AppendVarInt(buf []byte, v int32) []byte {
+	u := uint32(v)
+	for {
+		if u&^0x7f == 0 {
+			return append(buf, byte(u))
+		}
+		buf = append(buf, byte(u&0x7f|0x80))
+		u >>= 7
+	}
+}
+
+// ReadVarInt decodes a VarInt from r.
+func ReadVarInt(r io.ByteReader) (int32, error) {
+	var result uint32
+	for i := 0; i < maxVarIntBytes; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		result |= uint32(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(result), nil
+		}
+	}
+	return 0, ErrVarIntTooBig
+}
+
+// AppendString appends a VarInt length-prefixed UTF-8 string to buf.
+func AppendString(buf []byte, s string) []byte {
+	buf = AppendVarInt(buf, int32(len(s)))
+	return append(buf, s...)
+}
+
+// ReadString decodes a VarInt length-prefixed string from r.
+func ReadString(r *bytes.Reader) (string, error) {
+	length, err := ReadVarInt(r)
+	if err != nil {
+		return "", err
+	}
+	if length < 0 || int(length) > r.Len() {
+		return "", fmt.Errorf("slp: invalid string length %d", length)
+	}
+	s := make([]byte, length)
+	if _, err := io.ReadFull(r, s); err != nil {
+		return "", err
+	}
+	return string(s), nil
+}
@@ -0,0 +1,242 @@
+package slp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestVarIntRoundTrip(t *testing.T) {
+	tests := []struct {
+		value   int32
+		encoded []byte
+	}{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{255, []byte{0xff, 0x01}},
+		{25565, []byte{0xdd, 0xc7, 0x01}},
+		{2097151, []byte{0xff, 0xff, 0x7f}},
+		{2147483647, []byte{0xff, 0xff, 0xff, 0xff, 0x07}},
+		{-1, []byte{0xff, 0xff, 0xff, 0xff, 0x0f}},
+		{-2147483648, []byte{0x80, 0x80, 0x80, 0x80, 0x08}},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(int(tt.value)), func(t *testing.T) {
+			encoded := AppendVarInt(nil, tt.value)
+			if !bytes.Equal(encoded, tt.encoded) {
+				t.Fatalf("AppendVarInt(%d) = % x, want % x", tt.value, encoded, tt.encoded)
+			}
+			decoded, err := ReadVarInt(bytes.NewReader(encoded))
+			if err != nil {
+				t.Fatalf("ReadVarInt(% x): %v", encoded, err)
+			}
+			if decoded != tt.value {
+				t.Fatalf("ReadVarInt(% x) = %d, want %d", encoded, decoded, tt.value)
+			}
+		})
+	}
+}
+
+func TestReadVarIntErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded []byte
+		wantErr error
+	}{
+		{"more than five bytes", []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x01}, ErrVarIntTooBig},
+		{"continuation on fifth byte", []byte{0xff, 0xff, 0xff, 0xff, 0xff}, ErrVarIntTooBig},
+		{"truncated", []byte{0x80}, io.EOF},
+		{"empty", nil, io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadVarInt(bytes.NewReader(tt.encoded))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReadVarInt(% x) error = %v, want %v", tt.encoded, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPlayersNames(t *testing.T) {
+	players := Players{Sample: []Player{
+		{Name: "alice", ID: "069a79f4-44e9-4726-a5be-fca90e38aaf5"},
+		{Name: "Anonymous Player", ID: anonymousID},
+		{Name: "", ID: "853c80ef-3c37-49fd-aa49-938b674adae6"},
+		{Name: "bob", ID: "61699b2e-d327-4a01-9f1e-0ea8c3f06bc6"},
+	}}
+	if got, want := players.Names(), []string{"alice", "bob"}; !slices.Equal(got, want) {
+		t.Fatalf("Names() = %q, want %q", got, want)
+	}
+	if got := (Players{}).Names(); len(got) != 0 {
+		t.Fatalf("Names() of an empty sample = %q, want none", got)
+	}
+}
+
+// statusPacket frames a status response carrying body.
+func statusPacket(body string) []byte {
+	return buildPacket(packetIDStatus, AppendString(nil, body))
+}
+
+// serve answers one status request on conn with response after checking the
+// handshake and status request.
+func serve(t *testing.T, conn net.Conn, response []byte) {
+	t.Helper()
+	// nolint: errcheck
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	handshake, err := readPacket(r, packetIDHandshake)
+	if err != nil {
+		t.Errorf("read handshake: %v", err)
+		return
+	}
+	hr := bytes.NewReader(handshake)
+	if version, err := ReadVarInt(hr); err != nil || version != protocolVersion {
+		t.Errorf("handshake protocol version = %d, %v, want %d", version, err, protocolVersion)
+	}
+	if host, err := ReadString(hr); err != nil || host != "mc.example.com" {
+		t.Errorf("handshake host = %q, %v, want mc.example.com", host, err)
+	}
+	var port uint16
+	if err := binary.Read(hr, binary.BigEndian, &port); err != nil || port != 25565 {
+		t.Errorf("handshake port = %d, %v, want 25565", port, err)
+	}
+	if state, err := ReadVarInt(hr); err != nil || state != nextStateStatus {
+		t.Errorf("handshake next state = %d, %v, want %d", state, err, nextStateStatus)
+	}
+	if request, err := readPacket(r, packetIDStatus); err != nil || len(request) != 0 {
+		t.Errorf("status request = % x, %v, want an empty payload", request, err)
+		return
+	}
+	_, _ = conn.Write(response)
+}
+
+func TestExchange(t *testing.T) {
+	tests := []struct {
+		name     string
+		response []byte
+		want     *Status
+		wantErr  error
+	}{
+		{
+			name: "status",
+			response: statusPacket(`{"version":{"name":"1.21.1","protocol":767},` +
+				`"players":{"max":20,"online":2,"sample":[{"name":"alice","id":"069a79f4-44e9-4726-a5be-fca90e38aaf5"},` +
+				`{"name":"Anonymous Player","id":"00000000-0000-0000-0000-000000000000"}]},"description":{"text":"hi"}}`),
+			want: &Status{
+				Version: Version{Name: "1.21.1", Protocol: 767},
+				Players: Players{Max: 20, Online: 2, Sample: []Player{
+					{Name: "alice", ID: "069a79f4-44e9-4726-a5be-fca90e38aaf5"},
+					{Name: "Anonymous Player", ID: anonymousID},
+				}},
+			},
+		},
+		{
+			name:     "oversized packet",
+			response: AppendVarInt(nil, maxPacketSize+1),
+			wantErr:  ErrPacketTooLarge,
+		},
+		{
+			name:     "zero-length packet",
+			response: AppendVarInt(nil, 0),
+			wantErr:  ErrEmptyPacket,
+		},
+		{
+			name:     "negative length",
+			response: AppendVarInt(nil, -1),
+			wantErr:  ErrEmptyPacket,
+		},
+		{
+			name:     "wrong packet id",
+			response: buildPacket(0x01, AppendString(nil, `{}`)),
+			wantErr:  ErrUnexpectedPacket,
+		},
+		{
+			name:     "truncated body",
+			response: AppendVarInt(nil, 10),
+			wantErr:  io.EOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			// nolint: errcheck
+			defer client.Close()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				serve(t, server, tt.response)
+			}()
+
+			got, err := exchange(client, "mc.example.com", 25565)
+			<-done
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("exchange() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("exchange(): %v", err)
+			}
+			if got.Version != tt.want.Version || got.Players.Max != tt.want.Players.Max ||
+				got.Players.Online != tt.want.Players.Online || !slices.Equal(got.Players.Sample, tt.want.Players.Sample) {
+				t.Fatalf("exchange() = %+v, want %+v", got, tt.want)
+			}
+			if got, want := got.Players.Names(), []string{"alice"}; !slices.Equal(got, want) {
+				t.Fatalf("Names() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nolint: errcheck
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		// nolint: errcheck
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for _, id := range []int32{packetIDHandshake, packetIDStatus} {
+			if _, err := readPacket(r, id); err != nil {
+				return
+			}
+		}
+		_, _ = conn.Write(statusPacket(`{"version":{"name":"1.21.1","protocol":767},"players":{"max":20,"online":0}}`))
+	}()
+
+	status, err := Ping(context.Background(), ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Ping(): %v", err)
+	}
+	if status.Version.Protocol != 767 || status.Players.Max != 20 || status.Players.Online != 0 {
+		t.Fatalf("Ping() = %+v", status)
+	}
+}
+
+func TestPingInvalidAddress(t *testing.T) {
+	for _, addr := range []string{"localhost", "localhost:port", "localhost:70000"} {
+		if _, err := Ping(context.Background(), addr); err == nil {
+			t.Errorf("Ping(%q) succeeded, want an error", addr)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Package wake defines how the query log forwarder in us-east-1 hands Route53
+// query log records to the launcher in the server's region.
+package wake
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Mode selects how query log records reach the launcher.
+type Mode string
+
+// Wake modes.
+const (
+	// Logs writes the records into a log group in the server's region, whose
+	// subscription filter invokes the launcher.
+	Logs Mode = "logs"
+	// EventBridge sends a ServerWakeRequested event to the default event bus
+	// of the server's region, a rule there invokes the launcher.
+	EventBridge Mode = "eventbridge"
+	// Invoke invokes the launcher asynchronously.
+	Invoke Mode = "invoke"
+)
+
+// ParseMode parses s as a wake mode.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case Logs, EventBridge, Invoke:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown wake mode %q, want %s, %s or %s", s, Logs, EventBridge, Invoke)
+	}
+}
+
+// EventBridge event source and detail type of a Request.
+const (
+	Source     = "minecraft.querylog"
+	DetailType = "ServerWakeRequested"
+)
+
+// Version is the version of the Request payload.
+const Version = 1
+
+// MaxRequestSize is the size budget of a Request in bytes. Both an
+// EventBridge entry and an asynchronous invocation are limited to 256 KiB,
+// the rest is left for the event envelope.
+const MaxRequestSize = 240 * 1024
+
+// Request asks the launcher to start the server. It carries the raw query
+// log records, the launcher applies its filters as it does for records
+// delivered by a subscription filter.
+type Request struct {
+	Version int `json:"version"`
+	// Server is the name of the server, e.g. "mc.example.com".
+	Server    string                          `json:"server"`
+	LogGroup  string                          `json:"log_group"`
+	LogStream string                          `json:"log_stream"`
+	Records   []events.CloudwatchLogsLogEvent `json:"records"`
+}
+
+// MatchServer returns the server of servers a query for name, as parsed by
+// querylog.Parse, is meant for: the server whose name is name or its longest
+// suffix, e.g. "mc.example.com" for "_minecraft._tcp.mc.example.com". A
+// single server matches every name, the subscription filter only passes its
+// queries.
+func MatchServer(name string, servers []string) (string, bool) {
+	if len(servers) == 1 {
+		return servers[0], true
+	}
+	match := ""
+	for _, server := range servers {
+		if (name == server || strings.HasSuffix(name, "."+server)) && len(server) > len(match) {
+			match = server
+		}
+	}
+	return match, match != ""
+}
+
+// NewRequests wraps the records of a subscription payload into requests
+// within MaxRequestSize.
+func NewRequests(server string, data events.CloudwatchLogsData) ([]Request, error) {
+	var requests []Request
+	var records []events.CloudwatchLogsLogEvent
+	size := 0
+	flush := func() {
+		requests = append(requests, Request{
+			Version:   Version,
+			Server:    server,
+			LogGroup:  data.LogGroup,
+			LogStream: data.LogStream,
+			Records:   records,
+		})
+		records, size = nil, 0
+	}
+	for _, record := range data.LogEvents {
+		// Messages may grow when escaped, so the encoded size is measured.
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		recordSize := len(encoded) + 1
+		if len(records) > 0 && size+recordSize > MaxRequestSize {
+			flush()
+		}
+		records = append(records, record)
+		size += recordSize
+	}
+	if len(records) > 0 {
+		flush()
+	}
+	return requests, nil
+}
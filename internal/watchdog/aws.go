@@ -0,0 +1,211 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/capacity"
+)
+
+// resolvePublicIP returns the public IPv4 and, in dual-stack subnets, the IPv6
+// address of the task's network interface. ipv6 is empty if none is assigned.
+func (w *Watchdog) resolvePublicIP(ctx context.Context, taskID string) (ipv4, ipv6 string, err error) {
+	resp, err := w.deps.ECS.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(w.cfg.Cluster),
+		Tasks:   []string{taskID},
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to describe ECS task: %w", err)
+	}
+	if len(resp.Tasks) == 0 || len(resp.Tasks[0].Attachments) == 0 {
+		return "", "", errors.New("failed to describe ECS task: no task attachments found")
+	}
+
+	var eni string
+	for _, detail := range resp.Tasks[0].Attachments[0].Details {
+		if detail.Name != nil && *detail.Name == "networkInterfaceId" {
+			eni = *detail.Value
+			break
+		}
+	}
+
+	respEC2, err := w.deps.EC2.DescribeNetworkInterfaces(ctx, &ec2.DescribeNetworkInterfacesInput{
+		NetworkInterfaceIds: []string{eni},
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to describe network interfaces: %w", err)
+	}
+	if len(respEC2.NetworkInterfaces) == 0 || respEC2.NetworkInterfaces[0].Association == nil {
+		return "", "", fmt.Errorf("network interface %s has no public IP", eni)
+	}
+	iface := respEC2.NetworkInterfaces[0]
+	for _, addr := range iface.Ipv6Addresses {
+		if addr.Ipv6Address != nil {
+			ipv6 = *addr.Ipv6Address
+			break
+		}
+	}
+	return aws.ToString(iface.Association.PublicIp), ipv6, nil
+}
+
+// updateDNSRecord upserts the A record and, if the task has an IPv6 address,
+// the AAAA record of the server. If SRVPort is set, the SRV record of the
+// server is pointed at the server name and that port.
+func (w *Watchdog) updateDNSRecord(ctx context.Context, publicIP, publicIPv6 string) error {
+	changes := []types.Change{w.recordChange(types.ChangeActionUpsert, types.RRTypeA, w.cfg.ServerName, publicIP)}
+	if publicIPv6 != "" {
+		changes = append(changes, w.recordChange(types.ChangeActionUpsert, types.RRTypeAaaa, w.cfg.ServerName, publicIPv6))
+	}
+	if w.cfg.SRVPort != 0 {
+		target := fmt.Sprintf("%d %d %d %s.", srvPriority, srvWeight, w.cfg.SRVPort, strings.TrimSuffix(w.cfg.ServerName, "."))
+		changes = append(changes, w.recordChange(types.ChangeActionUpsert, types.RRTypeSrv, srvPrefix+w.cfg.ServerName, target))
+	}
+	if _, err := w.changeRecords(ctx, changes); err != nil {
+		return fmt.Errorf("failed to update DNS record: %w", err)
+	}
+	w.logger.Info("DNS record updated",
+		slog.String("ServerName", w.cfg.ServerName),
+		slog.String("IP", publicIP),
+		slog.String("IPv6", publicIPv6),
+	)
+	return nil
+}
+
+// resetDNSRecord points the A record back to the parking IP, removes the AAAA
+// record if one was published and waits until the change has propagated to
+// all Route53 name servers.
+func (w *Watchdog) resetDNSRecord(ctx context.Context) error {
+	changes := []types.Change{w.recordChange(types.ChangeActionUpsert, types.RRTypeA, w.cfg.ServerName, w.cfg.DNSParkingIP)}
+	if ipv6 := w.status.snapshot().PublicIPv6; ipv6 != "" {
+		changes = append(changes, w.recordChange(types.ChangeActionDelete, types.RRTypeAaaa, w.cfg.ServerName, ipv6))
+	}
+	changeID, err := w.changeRecords(ctx, changes)
+	var invalid *types.InvalidChangeBatch
+	if errors.As(err, &invalid) && len(changes) > 1 {
+		// The AAAA record was never published if the upsert failed before
+		// Route53 applied it, and deleting a missing record fails the batch.
+		w.logger.Warn("Failed to delete AAAA record, resetting A record only", slog.String("error", err.Error()))
+		changeID, err = w.changeRecords(ctx, changes[:1])
+	}
+	if err != nil {
+		w.metrics.dnsResetErrors.Inc()
+		return fmt.Errorf("failed to reset DNS record: %w", err)
+	}
+
+	waiter := route53.NewResourceRecordSetsChangedWaiter(w.deps.Route53, func(o *route53.ResourceRecordSetsChangedWaiterOptions) {
+		o.MinDelay = dnsSyncMinDelay
+		o.MaxDelay = dnsSyncMaxDelay
+	})
+	timeout := dnsSyncTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline))
+	}
+	if err := waiter.Wait(ctx, &route53.GetChangeInput{Id: aws.String(changeID)}, timeout); err != nil {
+		w.metrics.dnsResetErrors.Inc()
+		return fmt.Errorf("DNS reset %s did not reach INSYNC: %w", changeID, err)
+	}
+	w.logger.Info("DNS record reset", slog.String("ServerName", w.cfg.ServerName), slog.String("IP", w.cfg.DNSParkingIP))
+	return nil
+}
+
+// recordChange returns a change of the rrType record name to value.
+// Deletions must match the current value and TTL exactly.
+func (w *Watchdog) recordChange(action types.ChangeAction, rrType types.RRType, name, value string) types.Change {
+	return types.Change{
+		Action: action,
+		ResourceRecordSet: &types.ResourceRecordSet{
+			Name: aws.String(name),
+			Type: rrType,
+			TTL:  aws.Int64(dnsTTL),
+			ResourceRecords: []types.ResourceRecord{
+				{Value: aws.String(value)},
+			},
+		},
+	}
+}
+
+// changeRecords applies changes atomically and returns the change ID.
+func (w *Watchdog) changeRecords(ctx context.Context, changes []types.Change) (string, error) {
+	resp, err := w.deps.Route53.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(w.cfg.DNSZone),
+		ChangeBatch:  &types.ChangeBatch{Changes: changes},
+	})
+	if err != nil {
+		return "", err
+	}
+	w.metrics.dnsUpdates.Inc()
+	if resp.ChangeInfo == nil {
+		return "", errors.New("no change info returned")
+	}
+	return aws.ToString(resp.ChangeInfo.Id), nil
+}
+
+// scaleDown sets the desired count of the service to zero.
+func (w *Watchdog) scaleDown(ctx context.Context) error {
+	_, err := w.deps.ECS.UpdateService(ctx, &ecs.UpdateServiceInput{
+		Cluster:      aws.String(w.cfg.Cluster),
+		Service:      aws.String(w.cfg.Service),
+		DesiredCount: aws.Int32(0),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set service desired count to zero: %w", err)
+	}
+	return nil
+}
+
+// stopReason asks ECS why the task is stopping and returns a description and
+// the stop code. It falls back to a generic reason if the task is unknown or
+// ECS has not recorded a reason yet.
+func (w *Watchdog) stopReason(ctx context.Context) (string, ecstypes.TaskStopCode) {
+	const fallback = "SIGTERM received"
+	if w.taskARN == "" {
+		return fallback, ""
+	}
+	resp, err := w.deps.ECS.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(w.cfg.Cluster),
+		Tasks:   []string{w.taskARN},
+	})
+	if err != nil {
+		w.logger.Error("Failed to describe stopping task", slog.String("error", err.Error()))
+		return fallback, ""
+	}
+	if len(resp.Tasks) == 0 {
+		return fallback, ""
+	}
+	task := resp.Tasks[0]
+	switch {
+	case task.StoppedReason != nil && task.StopCode != "":
+		return fmt.Sprintf("%s (%s)", aws.ToString(task.StoppedReason), task.StopCode), task.StopCode
+	case task.StoppedReason != nil:
+		return aws.ToString(task.StoppedReason), ""
+	case task.StopCode != "":
+		return string(task.StopCode), task.StopCode
+	default:
+		return fallback, ""
+	}
+}
+
+// useOnDemandCapacity moves the service to on-demand Fargate so the task ECS
+// starts to replace an interrupted Spot task is not interrupted again.
+func (w *Watchdog) useOnDemandCapacity(ctx context.Context) error {
+	_, err := w.deps.ECS.UpdateService(ctx, &ecs.UpdateServiceInput{
+		Cluster:                  aws.String(w.cfg.Cluster),
+		Service:                  aws.String(w.cfg.Service),
+		CapacityProviderStrategy: capacity.Strategy(capacity.ProviderFargate),
+		ForceNewDeployment:       true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to move service to on-demand capacity: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package watchdog
+
+import "time"
+
+// Config holds the watchdog settings. Fields are populated from the
+// environment by go-arg in cmd/watchdog.
+type Config struct {
+	Cluster      string `arg:"env:CLUSTER,required" help:"ECS cluster name"`
+	Service      string `arg:"env:SERVICE,required" help:"ECS service name"`
+	ServerName   string `arg:"env:SERVERNAME,required" help:"Full A record in Route53"`
+	DNSZone      string `arg:"env:DNSZONE,required" help:"Route53 Hosted Zone ID"`
+	DNSParkingIP string `arg:"env:DNS_PARKING_IP" default:"192.168.1.1" help:"A record value restored on shutdown"`
+	SRVPort      int    `arg:"env:SRV_PORT" help:"Port published in the _minecraft._tcp SRV record, disabled if unset"`
+	CapacityMode string `arg:"env:CAPACITY_MODE" default:"fargate" help:"Capacity mode: fargate, spot or spot-fallback"`
+
+	SessionStore string `arg:"env:SESSION_STORE" default:"jsonl" help:"Player session store: jsonl, dynamodb or none"`
+	SessionFile  string `arg:"env:SESSION_FILE" default:"/data/watchdog/sessions.jsonl" help:"Session journal of the jsonl store"`
+	SessionTable string `arg:"env:SESSION_TABLE" help:"DynamoDB table of the dynamodb store"`
+	SNSTopic     string `arg:"env:SNSTOPIC" help:"SNS topic for notifications"`
+
+	ResolverTable    string        `arg:"env:RESOLVER_TABLE" help:"DynamoDB table of learned resolvers, learning is disabled if unset"`
+	ResolverLearnTTL time.Duration `arg:"env:RESOLVER_LEARN_TTL" default:"720h" help:"How long a resolver that led to a player session is remembered"`
+
+	DiscordWebhookURL string `arg:"env:DISCORD_WEBHOOK_URL" help:"Discord webhook notifications are posted to"`
+	SlackWebhookURL   string `arg:"env:SLACK_WEBHOOK_URL" help:"Slack incoming webhook notifications are posted to"`
+	WebhookURL        string `arg:"env:WEBHOOK_URL" help:"URL notifications are posted to as JSON"`
+
+	StartupMin   int    `arg:"env:STARTUPMIN" default:"10" help:"Startup wait time in minutes"`
+	ShutdownMin  int    `arg:"env:SHUTDOWNMIN" default:"20" help:"Shutdown wait time in minutes"`
+	RCONPassword string `arg:"env:RCON_PASSWORD" help:"RCON password of the Java server"`
+
+	Edition   string `arg:"env:EDITION" help:"Server edition (java or bedrock), detected from listening ports if unset"`
+	GamePort  int    `arg:"env:GAME_PORT" help:"Port the server accepts players on, defaults to the edition's standard port"`
+	RCONPort  int    `arg:"env:RCON_PORT" default:"25575" help:"RCON port of the Java server"`
+	QueryPort int    `arg:"env:QUERY_PORT" help:"Port used to query the player count, defaults to the game port"`
+
+	ShutdownWarnings  []time.Duration `arg:"env:SHUTDOWN_WARNINGS" help:"In-game warnings before shutdown, e.g. 5m,1m,10s, empty uses the defaults"`
+	ServerStopTimeout time.Duration   `arg:"env:SERVER_STOP_TIMEOUT" default:"2m" help:"Time to wait for the server to exit after stop"`
+	StopTimeout       time.Duration   `arg:"env:STOP_TIMEOUT" default:"100s" help:"Time budget for the emergency drain after SIGTERM, keep below the container stop timeout"`
+
+	HTTPPort    int  `arg:"env:HTTP_PORT" default:"8080" help:"Port of the status and health endpoints"`
+	HealthCheck bool `arg:"--healthcheck" help:"Query the local health endpoint and exit"`
+}
+
+// DefaultShutdownWarnings are announced in-game before the server is stopped.
+var DefaultShutdownWarnings = []time.Duration{5 * time.Minute, time.Minute, 10 * time.Second}
+
+// Editions supported by the watchdog.
+const (
+	EditionJava    = "java"
+	EditionBedrock = "bedrock"
+)
+
+// GamePortFor returns the game port of edition. An explicit GamePort applies
+// to the configured edition, or to both while the edition is still unknown.
+func (c Config) GamePortFor(edition string) int {
+	if c.GamePort != 0 && (c.Edition == "" || c.Edition == edition) {
+		return c.GamePort
+	}
+	if edition == EditionBedrock {
+		return defaultBedrockPort
+	}
+	return defaultJavaPort
+}
+
+// QueryPortFor returns the port the status of edition is queried on.
+func (c Config) QueryPortFor(edition string) int {
+	if c.QueryPort != 0 && (c.Edition == "" || c.Edition == edition) {
+		return c.QueryPort
+	}
+	return c.GamePortFor(edition)
+}
+
+const (
+	defaultJavaPort    = 25565
+	defaultBedrockPort = 19132
+
+	checkInterval     = 1 * time.Minute
+	editionPoll       = 1 * time.Second
+	rconWaitInterval  = 1 * time.Second
+	rconDialTimeout   = 5 * time.Second
+	drainPollInterval = 5 * time.Second
+	serverExitPoll    = 1 * time.Second
+	maxStartupWait    = 10 * time.Minute // 600 seconds
+	dnsTTL            = 30
+	dnsSyncTimeout    = 60 * time.Second
+	dnsSyncMinDelay   = 2 * time.Second
+	dnsSyncMaxDelay   = 10 * time.Second
+
+	// resolverWakeWindow is how long before the watchdog started the wakeup
+	// may have happened for its resolver to be learned.
+	resolverWakeWindow = 15 * time.Minute
+
+	// srvPrefix is prepended to the server name for the SRV record Java
+	// clients look up before falling back to the A record and port 25565.
+	srvPrefix   = "_minecraft._tcp."
+	srvPriority = 0
+	srvWeight   = 5
+)
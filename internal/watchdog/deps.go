@@ -0,0 +1,104 @@
+package watchdog
+
+import (
+	"context"
+	"net/netip"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/notify"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/rcon"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/sessions"
+)
+
+// ECSAPI is the subset of the ECS client used by the watchdog.
+type ECSAPI interface {
+	DescribeTasks(ctx context.Context, params *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error)
+	UpdateService(ctx context.Context, params *ecs.UpdateServiceInput, optFns ...func(*ecs.Options)) (*ecs.UpdateServiceOutput, error)
+}
+
+// EC2API is the subset of the EC2 client used by the watchdog.
+type EC2API interface {
+	DescribeNetworkInterfaces(ctx context.Context, params *ec2.DescribeNetworkInterfacesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeNetworkInterfacesOutput, error)
+}
+
+// Route53API is the subset of the Route53 client used by the watchdog.
+type Route53API interface {
+	ChangeResourceRecordSets(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error)
+	GetChange(ctx context.Context, params *route53.GetChangeInput, optFns ...func(*route53.Options)) (*route53.GetChangeOutput, error)
+}
+
+// Clock abstracts time so tests can run the lifecycle without waiting.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// TaskMetadata returns the ARN of the ECS task the watchdog runs in.
+type TaskMetadata interface {
+	TaskARN(ctx context.Context) (string, error)
+}
+
+// PlayerStatus is the result of probing the server for online players.
+// Max, Version and MOTD are left empty if the protocol does not report them.
+type PlayerStatus struct {
+	Online  int
+	Max     int
+	Names   []string
+	Version string
+	MOTD    string
+}
+
+// PlayerProbe reports the players currently online.
+type PlayerProbe interface {
+	Players(ctx context.Context) (PlayerStatus, error)
+}
+
+// PortProbe reports the state of local ports.
+type PortProbe interface {
+	// Listening reports whether a TCP socket is listening on port.
+	Listening(port int) bool
+	// Open reports whether any socket is bound to port.
+	Open(port int) bool
+}
+
+// Commander is the subset of the RCON client used by the watchdog.
+type Commander interface {
+	List(ctx context.Context) (rcon.PlayerList, error)
+	Say(ctx context.Context, message string) error
+	SaveAll(ctx context.Context) error
+	Stop(ctx context.Context) error
+	Close() error
+}
+
+// ResolverLearner remembers the resolver of the DNS query that woke the
+// server once a player joined. It returns the zero Addr if the last wakeup
+// happened before since.
+type ResolverLearner interface {
+	LearnLastWake(ctx context.Context, since, now time.Time) (netip.Addr, error)
+}
+
+// RCONDialer opens an authenticated RCON connection.
+type RCONDialer func(ctx context.Context) (Commander, error)
+
+// Deps bundles the external dependencies of a Watchdog.
+type Deps struct {
+	ECS      ECSAPI
+	EC2      EC2API
+	Route53  Route53API
+	Clock    Clock
+	Metadata TaskMetadata
+	Ports    PortProbe
+	Java     PlayerProbe
+	Bedrock  PlayerProbe
+	DialRCON RCONDialer
+	// Notifiers receive the startup and shutdown notifications. Without any,
+	// no notifications are sent.
+	Notifiers []notify.Notifier
+	// Sessions persists completed player sessions. It is optional.
+	Sessions sessions.Store
+	// Resolvers learns resolvers that led to player sessions. It is optional.
+	Resolvers ResolverLearner
+}
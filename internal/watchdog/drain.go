@@ -0,0 +1,129 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// drainServer warns players in-game, saves the world and stops the server.
+// It returns the steps taken and false if a player joined during the warnings.
+// If the world could not be flushed or the server did not exit, the error
+// wraps ErrUncleanShutdown.
+func (w *Watchdog) drainServer(ctx context.Context) ([]string, bool, error) {
+	var steps []string
+	step := func(msg string, args ...any) {
+		w.logger.Info(msg, args...)
+		steps = append(steps, msg)
+	}
+
+	if w.rcon == nil {
+		step("No RCON connection, skipping in-game shutdown sequence")
+		return steps, true, nil
+	}
+
+	warnings := slices.Clone(w.cfg.ShutdownWarnings)
+	slices.Sort(warnings)
+	slices.Reverse(warnings)
+
+	for i, warning := range warnings {
+		if err := w.rcon.Say(ctx, fmt.Sprintf("Server shutting down in %s due to inactivity.", humanDuration(warning))); err != nil {
+			step(fmt.Sprintf("Failed to announce shutdown in %s", humanDuration(warning)), slog.String("error", err.Error()))
+		} else {
+			step(fmt.Sprintf("Announced shutdown in %s", humanDuration(warning)))
+		}
+
+		next := time.Duration(0)
+		if i+1 < len(warnings) {
+			next = warnings[i+1]
+		}
+		players, err := w.waitForPlayers(ctx, warning-next)
+		if err != nil {
+			return steps, false, err
+		}
+		if players.Online > 0 {
+			_ = w.rcon.Say(ctx, "Shutdown aborted, welcome back!")
+			step("Shutdown aborted, player joined", slog.Any("names", players.Names))
+			return steps, false, nil
+		}
+	}
+
+	var failures []string
+	if err := w.rcon.SaveAll(ctx); err != nil {
+		step("Failed to flush world to disk", slog.String("error", err.Error()))
+		failures = append(failures, "world not flushed: "+err.Error())
+	} else {
+		step("World flushed to disk")
+	}
+
+	if err := w.rcon.Stop(ctx); err != nil {
+		step("Failed to send stop command", slog.String("error", err.Error()))
+		failures = append(failures, "stop command failed: "+err.Error())
+	} else {
+		step("Stop command sent")
+		exited, err := w.waitForServerExit(ctx, w.cfg.ServerStopTimeout)
+		if err != nil {
+			return steps, false, err
+		}
+		if exited {
+			step("Server process exited")
+		} else {
+			step(fmt.Sprintf("Server process did not exit within %s", w.cfg.ServerStopTimeout))
+			failures = append(failures, fmt.Sprintf("server did not exit within %s", w.cfg.ServerStopTimeout))
+		}
+	}
+
+	if len(failures) > 0 {
+		return steps, false, fmt.Errorf("%w: %s", ErrUncleanShutdown, strings.Join(failures, "; "))
+	}
+	return steps, true, nil
+}
+
+// waitForPlayers polls for players for up to d and returns as soon as one is online.
+func (w *Watchdog) waitForPlayers(ctx context.Context, d time.Duration) (PlayerStatus, error) {
+	deadline := w.deps.Clock.Now().Add(d)
+	for {
+		remaining := deadline.Sub(w.deps.Clock.Now())
+		if remaining <= 0 {
+			return PlayerStatus{}, nil
+		}
+		if err := w.sleep(ctx, min(remaining, drainPollInterval)); err != nil {
+			return PlayerStatus{}, err
+		}
+		if players := w.players(ctx); players.Online > 0 {
+			return players, nil
+		}
+	}
+}
+
+// waitForServerExit waits until the Java port stops listening.
+func (w *Watchdog) waitForServerExit(ctx context.Context, timeout time.Duration) (bool, error) {
+	deadline := w.deps.Clock.Now().Add(timeout)
+	for w.deps.Clock.Now().Before(deadline) {
+		if !w.serverListening(w.edition) {
+			return true, nil
+		}
+		if err := w.sleep(ctx, serverExitPoll); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// humanDuration formats d for in-game announcements, e.g. "5 minutes" or "10 seconds".
+func humanDuration(d time.Duration) string {
+	switch {
+	case d >= time.Minute && d%time.Minute == 0:
+		if d == time.Minute {
+			return "1 minute"
+		}
+		return fmt.Sprintf("%d minutes", d/time.Minute)
+	case d == time.Second:
+		return "1 second"
+	default:
+		return fmt.Sprintf("%d seconds", d/time.Second)
+	}
+}
@@ -0,0 +1,132 @@
+package watchdog
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// State is a lifecycle state of the watchdog.
+type State string
+
+// Lifecycle states.
+const (
+	StateBooting               State = "booting"
+	StateWaitingForServer      State = "waiting_for_server"
+	StateWaitingForFirstPlayer State = "waiting_for_first_player"
+	StateActive                State = "active"
+	StateIdle                  State = "idle"
+	StateDraining              State = "draining"
+	StateStopped               State = "stopped"
+	StateFailed                State = "failed"
+)
+
+// States lists all lifecycle states.
+var States = []State{
+	StateBooting,
+	StateWaitingForServer,
+	StateWaitingForFirstPlayer,
+	StateActive,
+	StateIdle,
+	StateDraining,
+	StateStopped,
+	StateFailed,
+}
+
+// Reason explains why a transition happened.
+type Reason string
+
+// Transition reasons.
+const (
+	ReasonDNSPublished   Reason = "dns_published"
+	ReasonServerReady    Reason = "server_ready"
+	ReasonPlayerJoined   Reason = "player_joined"
+	ReasonPlayersLeft    Reason = "players_left"
+	ReasonStartupTimeout Reason = "startup_timeout"
+	ReasonIdleTimeout    Reason = "idle_timeout"
+	ReasonScaledDown     Reason = "scaled_down"
+	ReasonTerminated     Reason = "terminated"
+	ReasonPreempted      Reason = "spot_interruption"
+	ReasonUncleanStop    Reason = "unclean_stop"
+	ReasonError          Reason = "error"
+)
+
+// transitions lists the states reachable from each state. Every non-terminal
+// state may also move to StateFailed.
+var transitions = map[State][]State{
+	StateBooting:               {StateWaitingForServer, StateDraining},
+	StateWaitingForServer:      {StateWaitingForFirstPlayer, StateDraining},
+	StateWaitingForFirstPlayer: {StateActive, StateDraining},
+	StateActive:                {StateIdle, StateDraining},
+	StateIdle:                  {StateActive, StateDraining},
+	StateDraining:              {StateActive, StateStopped},
+}
+
+// Event describes a single state transition.
+type Event struct {
+	From   State     `json:"from"`
+	To     State     `json:"to"`
+	Reason Reason    `json:"reason"`
+	At     time.Time `json:"at"`
+}
+
+// Lifecycle is the watchdog state machine. Subscribers are notified
+// synchronously, in order of subscription, after every transition.
+type Lifecycle struct {
+	clock Clock
+
+	mu          sync.Mutex
+	state       State
+	subscribers []func(Event)
+}
+
+// NewLifecycle returns a Lifecycle in StateBooting.
+func NewLifecycle(clock Clock) *Lifecycle {
+	return &Lifecycle{clock: clock, state: StateBooting}
+}
+
+// State returns the current state.
+func (l *Lifecycle) State() State {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state
+}
+
+// Subscribe registers fn to be called for every transition.
+func (l *Lifecycle) Subscribe(fn func(Event)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.subscribers = append(l.subscribers, fn)
+}
+
+// Transition moves the machine to the state to. Transitioning to the current
+// state is a no-op; transitions not allowed from the current state fail.
+func (l *Lifecycle) Transition(to State, reason Reason) error {
+	l.mu.Lock()
+	from := l.state
+	if from == to {
+		l.mu.Unlock()
+		return nil
+	}
+	if !canTransition(from, to) {
+		l.mu.Unlock()
+		return fmt.Errorf("invalid lifecycle transition from %s to %s (%s)", from, to, reason)
+	}
+	l.state = to
+	subscribers := slices.Clone(l.subscribers)
+	l.mu.Unlock()
+
+	event := Event{From: from, To: to, Reason: reason, At: l.clock.Now()}
+	for _, fn := range subscribers {
+		fn(event)
+	}
+	return nil
+}
+
+func canTransition(from, to State) bool {
+	if from == StateStopped || from == StateFailed {
+		return false
+	}
+	return to == StateFailed || slices.Contains(transitions[from], to)
+}
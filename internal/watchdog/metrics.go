@@ -0,0 +1,125 @@
+package watchdog
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "minecraft_watchdog"
+
+// metrics holds the Prometheus collectors of a Watchdog. Each Watchdog owns
+// its registry, so several instances, e.g. in tests, do not share state.
+type metrics struct {
+	registry *prometheus.Registry
+
+	playersOnline      prometheus.Gauge
+	idleMinutes        prometheus.Gauge
+	shutdownMinutes    prometheus.Gauge
+	serverReady        prometheus.Gauge
+	timeToReady        prometheus.Gauge
+	state              *prometheus.GaugeVec
+	transitions        *prometheus.CounterVec
+	probeFailures      *prometheus.CounterVec
+	dnsUpdates         prometheus.Counter
+	dnsResetErrors     prometheus.Counter
+	notificationErrors *prometheus.CounterVec
+}
+
+// newMetrics returns the watchdog collectors registered on a new registry.
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+
+		playersOnline: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "players_online",
+			Help:      "Number of players currently online.",
+		}),
+		idleMinutes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "idle_minutes",
+			Help:      "Minutes without any player online.",
+		}),
+		shutdownMinutes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "shutdown_minutes",
+			Help:      "Idle minutes after which the server is shut down.",
+		}),
+		serverReady: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "server_ready",
+			Help:      "Whether the Minecraft server accepts players (1) or not (0).",
+		}),
+		timeToReady: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "time_to_ready_seconds",
+			Help:      "Seconds from watchdog start until the Minecraft server was ready.",
+		}),
+		state: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "state",
+			Help:      "Current lifecycle state (1 for the active state, 0 otherwise).",
+		}, []string{"state"}),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "transitions_total",
+			Help:      "Lifecycle transitions by source state, target state and reason.",
+		}, []string{"from", "to", "reason"}),
+		probeFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "probe_failures_total",
+			Help:      "Failed server probes by probe type.",
+		}, []string{"probe"}),
+		dnsUpdates: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "dns_updates_total",
+			Help:      "Successful Route53 record updates.",
+		}),
+		dnsResetErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "dns_reset_errors_total",
+			Help:      "Failures to reset the Route53 record to the parking IP on shutdown.",
+		}),
+		notificationErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "notification_errors_total",
+			Help:      "Failed notification deliveries by sink.",
+		}, []string{"sink"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.playersOnline,
+		m.idleMinutes,
+		m.shutdownMinutes,
+		m.serverReady,
+		m.timeToReady,
+		m.state,
+		m.transitions,
+		m.probeFailures,
+		m.dnsUpdates,
+		m.dnsResetErrors,
+		m.notificationErrors,
+	)
+	return m
+}
+
+// observeTransition records a lifecycle event.
+func (m *metrics) observeTransition(event Event) {
+	for _, state := range States {
+		value := 0.0
+		if state == event.To {
+			value = 1
+		}
+		m.state.WithLabelValues(string(state)).Set(value)
+	}
+	m.transitions.WithLabelValues(string(event.From), string(event.To), string(event.Reason)).Inc()
+}
+
+// handler serves the watchdog metrics in the Prometheus exposition format.
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
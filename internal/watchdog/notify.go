@@ -0,0 +1,129 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/notify"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/sessions"
+)
+
+func (w *Watchdog) sendStartupNotification(ctx context.Context, publicIP, publicIPv6 string) {
+	if len(w.deps.Notifiers) == 0 {
+		return
+	}
+	n := w.newNotification(notify.EventStartup, "Server is online.")
+	n.Fields = []notify.Field{
+		{Name: "Service", Value: w.cfg.Service},
+		{Name: "Edition", Value: w.edition},
+		{Name: "Address", Value: fmt.Sprintf("%s (%s)", w.cfg.ServerName, publicIP)},
+		{Name: "Cluster", Value: w.cfg.Cluster},
+	}
+	if publicIPv6 != "" {
+		n.Fields = append(n.Fields, notify.Field{Name: "IPv6", Value: publicIPv6})
+	}
+	info := w.players(ctx)
+	n.Players = info.Names
+	if info.Version != "" {
+		n.Fields = append(n.Fields,
+			notify.Field{Name: "Version", Value: info.Version},
+			notify.Field{Name: "Players", Value: fmt.Sprintf("%d/%d", info.Online, info.Max)},
+		)
+		if info.MOTD != "" {
+			n.Fields = append(n.Fields, notify.Field{Name: "MOTD", Value: info.MOTD})
+		}
+	}
+	w.notify(ctx, n)
+}
+
+func (w *Watchdog) sendShutdownNotification(ctx context.Context, lastPlayers, steps []string) {
+	if len(w.deps.Notifiers) == 0 {
+		return
+	}
+	n := w.newNotification(notify.EventShutdown, "Shutting down server.")
+	n.Players = lastPlayers
+	n.Fields = []notify.Field{
+		{Name: "Service", Value: w.cfg.Service},
+		{Name: "Address", Value: w.cfg.ServerName},
+		{Name: "Cluster", Value: w.cfg.Cluster},
+	}
+	if len(lastPlayers) > 0 {
+		n.Fields = append(n.Fields, notify.Field{Name: "Last seen players", Value: strings.Join(lastPlayers, ", ")})
+	}
+	addSessionSummary(&n, w.sessions.Summary())
+	if len(steps) > 0 {
+		n.Sections = append(n.Sections, notify.Section{Title: "Shutdown sequence", Items: steps})
+	}
+	w.notify(ctx, n)
+}
+
+func (w *Watchdog) sendUnexpectedStopNotification(ctx context.Context, headline, reason string, lastPlayers, steps []string) {
+	if len(w.deps.Notifiers) == 0 {
+		return
+	}
+	n := w.newNotification(notify.EventUnexpectedStop, headline)
+	n.Players = lastPlayers
+	n.Fields = []notify.Field{
+		{Name: "Reason", Value: reason},
+		{Name: "Service", Value: w.cfg.Service},
+		{Name: "Address", Value: w.cfg.ServerName},
+		{Name: "Cluster", Value: w.cfg.Cluster},
+	}
+	if len(lastPlayers) > 0 {
+		n.Fields = append(n.Fields, notify.Field{Name: "Players online", Value: strings.Join(lastPlayers, ", ")})
+	}
+	addSessionSummary(&n, w.sessions.Summary())
+	if len(steps) > 0 {
+		n.Sections = append(n.Sections, notify.Section{Title: "Emergency sequence", Items: steps})
+	}
+	w.notify(ctx, n)
+}
+
+func (w *Watchdog) newNotification(event notify.Event, title string) notify.Notification {
+	return notify.Notification{
+		Event:   event,
+		Title:   title,
+		Service: w.cfg.Service,
+		Edition: w.edition,
+		Address: w.cfg.ServerName,
+		Time:    w.deps.Clock.Now(),
+	}
+}
+
+// notify delivers n to every configured sink. A failing sink is logged and
+// counted but does not keep the others from being notified.
+func (w *Watchdog) notify(ctx context.Context, n notify.Notification) {
+	for _, notifier := range w.deps.Notifiers {
+		if err := notifier.Notify(ctx, n); err != nil {
+			w.metrics.notificationErrors.WithLabelValues(notifier.Name()).Inc()
+			w.logger.Error("Failed to send notification",
+				slog.String("sink", notifier.Name()),
+				slog.String("event", string(n.Event)),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
+
+// addSessionSummary adds the playtime per player to n. Nothing is added if no
+// sessions were tracked.
+func addSessionSummary(n *notify.Notification, summary sessions.Summary) {
+	totals := summary.Totals()
+	if len(totals) == 0 {
+		return
+	}
+	if summary.LastToLeave != "" {
+		n.Fields = append(n.Fields, notify.Field{Name: "Last to leave", Value: summary.LastToLeave})
+	}
+	section := notify.Section{Title: "Sessions"}
+	for _, total := range totals {
+		item := fmt.Sprintf("%s: %s", total.Player, sessions.FormatDuration(total.Duration))
+		if total.Sessions > 1 {
+			item += fmt.Sprintf(" (%d sessions)", total.Sessions)
+		}
+		section.Items = append(section.Items, item)
+	}
+	n.Sections = append(n.Sections, section)
+}
@@ -0,0 +1,144 @@
+package watchdog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/raknet"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/rcon"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/slp"
+	psnet "github.com/shirou/gopsutil/net"
+)
+
+const (
+	bedrockPingWait = 1 * time.Second
+	javaPingWait    = 5 * time.Second
+)
+
+// RealClock is a Clock backed by the time package.
+type RealClock struct{}
+
+// Now returns the current time.
+func (RealClock) Now() time.Time { return time.Now() }
+
+// After waits for d to elapse and then sends the current time on the returned channel.
+func (RealClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// ECSMetadata reads the task ARN from the ECS task metadata endpoint v4.
+type ECSMetadata struct {
+	Endpoint string
+}
+
+// TaskARN returns the ARN of the running task.
+func (m ECSMetadata) TaskARN(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.Endpoint+"/task", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get task metadata: %w", err)
+	}
+
+	// nolint: errcheck
+	defer resp.Body.Close()
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to parse task metadata: %w", err)
+	}
+
+	if taskID, ok := result["TaskARN"].(string); ok {
+		return taskID, nil
+	}
+	return "", errors.New("invalid task ARN received")
+}
+
+// NetstatPorts inspects local sockets via gopsutil.
+type NetstatPorts struct{}
+
+// Open reports whether any socket is bound to port.
+func (NetstatPorts) Open(port int) bool {
+	conns, _ := psnet.Connections("all")
+	for _, conn := range conns {
+		if int(conn.Laddr.Port) == port {
+			return true
+		}
+	}
+	return false
+}
+
+// Listening reports whether a socket on port is in LISTEN state.
+func (NetstatPorts) Listening(port int) bool {
+	conns, _ := psnet.Connections("all")
+	for _, conn := range conns {
+		if int(conn.Laddr.Port) == port && conn.Status == "LISTEN" {
+			return true
+		}
+	}
+	return false
+}
+
+// JavaProbe queries a Java server via the Server List Ping protocol.
+type JavaProbe struct {
+	Addr string
+}
+
+// Players returns the online count and the names from the player sample.
+func (p JavaProbe) Players(ctx context.Context) (PlayerStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, javaPingWait)
+	defer cancel()
+
+	status, err := slp.Ping(ctx, p.Addr)
+	if err != nil {
+		return PlayerStatus{}, err
+	}
+	return PlayerStatus{
+		Online:  status.Players.Online,
+		Max:     status.Players.Max,
+		Names:   status.Players.Names(),
+		Version: status.Version.Name,
+	}, nil
+}
+
+// BedrockProbe queries a Bedrock server via a RakNet unconnected ping.
+type BedrockProbe struct {
+	Addr string
+}
+
+// Players returns the online count and server details reported in the pong.
+func (p BedrockProbe) Players(ctx context.Context) (PlayerStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, bedrockPingWait)
+	defer cancel()
+
+	pong, err := raknet.Ping(ctx, p.Addr)
+	if err != nil {
+		return PlayerStatus{}, err
+	}
+	return PlayerStatus{
+		Online:  pong.Status.Players,
+		Max:     pong.Status.MaxPlayers,
+		Version: pong.Status.Version,
+		MOTD:    pong.Status.MOTD,
+	}, nil
+}
+
+// NewRCONDialer returns an RCONDialer connecting to addr with password.
+func NewRCONDialer(addr, password string) RCONDialer {
+	return func(ctx context.Context) (Commander, error) {
+		client, err := rcon.Dial(ctx, addr, password)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+}
+
+// isAuthError reports whether err means the RCON password was rejected.
+func isAuthError(err error) bool {
+	return errors.Is(err, rcon.ErrAuthFailed)
+}
@@ -0,0 +1,43 @@
+package watchdog
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/sessions"
+)
+
+// trackSessions updates the session tracker from a successful probe. Probes
+// that report players without names, e.g. Bedrock, cannot be attributed.
+func (w *Watchdog) trackSessions(ctx context.Context, players PlayerStatus) {
+	if players.Online > 0 && len(players.Names) == 0 {
+		return
+	}
+	joined, ended := w.sessions.Update(players.Names, w.deps.Clock.Now())
+	for _, name := range joined {
+		w.logger.Info("Player joined", slog.String("player", name))
+	}
+	for _, session := range ended {
+		w.logger.Info("Player left",
+			slog.String("player", session.Player),
+			slog.Duration("duration", session.Duration()),
+		)
+		w.storeSession(ctx, session)
+	}
+}
+
+// endSessions ends and stores the sessions of all players still online.
+func (w *Watchdog) endSessions(ctx context.Context) {
+	for _, session := range w.sessions.EndAll(w.deps.Clock.Now()) {
+		w.storeSession(ctx, session)
+	}
+}
+
+func (w *Watchdog) storeSession(ctx context.Context, session sessions.Session) {
+	if w.deps.Sessions == nil {
+		return
+	}
+	if err := w.deps.Sessions.Append(ctx, session); err != nil {
+		w.logger.Error("Failed to store player session", slog.String("player", session.Player), slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,117 @@
+package watchdog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// serverStatus is the JSON document served on /status.
+type serverStatus struct {
+	Phase          State     `json:"phase"`
+	Ready          bool      `json:"ready"`
+	Edition        string    `json:"edition,omitempty"`
+	PublicIP       string    `json:"public_ip,omitempty"`
+	PublicIPv6     string    `json:"public_ipv6,omitempty"`
+	DNSName        string    `json:"dns_name"`
+	Players        int       `json:"players"`
+	PlayerNames    []string  `json:"player_names,omitempty"`
+	MaxPlayers     int       `json:"max_players,omitempty"`
+	Version        string    `json:"version,omitempty"`
+	MOTD           string    `json:"motd,omitempty"`
+	IdleMinutes    int       `json:"idle_minutes"`
+	ShutdownMin    int       `json:"shutdown_minutes"`
+	StartedAt      time.Time `json:"started_at"`
+	ReadyAt        time.Time `json:"ready_at,omitzero"`
+	StartupSeconds float64   `json:"startup_seconds,omitempty"`
+}
+
+// statusTracker holds the current serverStatus and is safe for concurrent use.
+type statusTracker struct {
+	metrics *metrics
+
+	mu     sync.RWMutex
+	status serverStatus
+}
+
+func newStatusTracker(cfg *Config, startedAt time.Time, m *metrics) *statusTracker {
+	m.shutdownMinutes.Set(float64(cfg.ShutdownMin))
+	return &statusTracker{
+		metrics: m,
+		status: serverStatus{
+			Phase:       StateBooting,
+			DNSName:     cfg.ServerName,
+			ShutdownMin: cfg.ShutdownMin,
+			StartedAt:   startedAt,
+		},
+	}
+}
+
+// update applies fn to the status under the write lock.
+func (t *statusTracker) update(fn func(s *serverStatus)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fn(&t.status)
+}
+
+// observe updates the phase and readiness from a lifecycle event.
+func (t *statusTracker) observe(event Event) {
+	t.update(func(s *serverStatus) {
+		s.Phase = event.To
+		switch {
+		case event.Reason == ReasonServerReady:
+			s.Ready = true
+			s.ReadyAt = event.At
+			s.StartupSeconds = s.ReadyAt.Sub(s.StartedAt).Seconds()
+			t.metrics.serverReady.Set(1)
+			t.metrics.timeToReady.Set(s.StartupSeconds)
+		case event.To == StateStopped || event.To == StateFailed:
+			s.Ready = false
+			t.metrics.serverReady.Set(0)
+		}
+	})
+}
+
+func (t *statusTracker) setPlayers(players PlayerStatus, idleMinutes int) {
+	t.update(func(s *serverStatus) {
+		s.Players = players.Online
+		s.PlayerNames = players.Names
+		if players.Version != "" {
+			s.MaxPlayers = players.Max
+			s.Version = players.Version
+			s.MOTD = players.MOTD
+		}
+		s.IdleMinutes = idleMinutes
+		t.metrics.playersOnline.Set(float64(players.Online))
+		t.metrics.idleMinutes.Set(float64(idleMinutes))
+	})
+}
+
+func (t *statusTracker) snapshot() serverStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.status
+}
+
+// Handler serves /healthz, /readyz, /status and /metrics.
+func (w *Watchdog) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(rw http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprintln(rw, "ok")
+	})
+	mux.HandleFunc("GET /readyz", func(rw http.ResponseWriter, _ *http.Request) {
+		if !w.status.snapshot().Ready {
+			http.Error(rw, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = fmt.Fprintln(rw, "ok")
+	})
+	mux.HandleFunc("GET /status", func(rw http.ResponseWriter, _ *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(rw).Encode(w.status.snapshot())
+	})
+	mux.Handle("GET /metrics", w.metrics.handler())
+	return mux
+}
@@ -0,0 +1,75 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/capacity"
+)
+
+// emergencyStop runs when ECS stops the task without the watchdog having
+// scaled the service down, e.g. on a deployment, Spot interruption or manual
+// stop. It flushes the world, reports the stop and parks the DNS record.
+// ctx bounds the whole sequence and must outlive the cancelled run context.
+func (w *Watchdog) emergencyStop(ctx context.Context) error {
+	reason, stopCode := w.stopReason(ctx)
+	preempted := stopCode == ecstypes.TaskStopCodeSpotInterruption
+	w.logger.Warn("Task is stopping, running emergency drain",
+		slog.String("reason", reason),
+		slog.Bool("preempted", preempted),
+	)
+
+	lifecycleReason := ReasonTerminated
+	headline := "Server stopped unexpectedly."
+	announcement := "Server is being stopped by the host, saving the world."
+	if preempted {
+		lifecycleReason = ReasonPreempted
+		headline = "Session preempted by a Spot interruption."
+		announcement = "AWS is reclaiming this server, saving the world. Please rejoin in a few minutes."
+	}
+	w.transition(StateDraining, lifecycleReason)
+
+	var steps []string
+	step := func(msg string, args ...any) {
+		w.logger.Info(msg, args...)
+		steps = append(steps, msg)
+	}
+
+	if w.rcon != nil {
+		if err := w.rcon.Say(ctx, announcement); err != nil {
+			step("Failed to warn players", slog.String("error", err.Error()))
+		} else {
+			step("Players warned in-game")
+		}
+		if err := w.rcon.SaveAll(ctx); err != nil {
+			step("Failed to flush world to disk", slog.String("error", err.Error()))
+		} else {
+			step("World flushed to disk")
+		}
+	} else {
+		step("No RCON connection, world not flushed")
+	}
+
+	if preempted && capacity.Mode(w.cfg.CapacityMode) == capacity.SpotWithFallback {
+		if err := w.useOnDemandCapacity(ctx); err != nil {
+			step("Failed to fall back to on-demand capacity", slog.String("error", err.Error()))
+		} else {
+			step("Replacement task requested on on-demand capacity")
+		}
+	}
+
+	dnsErr := w.resetDNSRecord(ctx)
+	if dnsErr != nil {
+		step("Failed to reset DNS record", slog.String("error", dnsErr.Error()))
+	} else {
+		step(fmt.Sprintf("DNS record reset to %s", w.cfg.DNSParkingIP))
+	}
+
+	online := w.status.snapshot().PlayerNames
+	w.endSessions(ctx)
+	w.sendUnexpectedStopNotification(ctx, headline, reason, online, steps)
+	w.transition(StateStopped, lifecycleReason)
+	return dnsErr
+}
@@ -0,0 +1,407 @@
+// Package watchdog monitors a Minecraft server running as an ECS task. It
+// publishes the task's public IP to Route53, waits for the server to become
+// ready and scales the ECS service to zero once nobody has been playing for a
+// while.
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/sessions"
+)
+
+// ErrNoInitialConnection is returned by Run when nobody joined within StartupMin
+// and the service was shut down.
+var ErrNoInitialConnection = errors.New("no initial client connection established, service shut down")
+
+// ErrUncleanShutdown is returned by Run when the service was scaled down
+// although the server could not be saved or did not exit after the stop
+// command.
+var ErrUncleanShutdown = errors.New("server did not shut down cleanly")
+
+// Watchdog drives the lifecycle of a single server task.
+type Watchdog struct {
+	cfg       Config
+	deps      Deps
+	logger    *slog.Logger
+	status    *statusTracker
+	lifecycle *Lifecycle
+	sessions  *sessions.Tracker
+	metrics   *metrics
+
+	taskARN string
+	edition string
+	rcon    Commander
+}
+
+// New returns a Watchdog using cfg and deps. Empty ShutdownWarnings, e.g.
+// from a SHUTDOWN_WARNINGS variable that is set but empty, fall back to
+// DefaultShutdownWarnings.
+func New(cfg Config, deps Deps, logger *slog.Logger) *Watchdog {
+	if len(cfg.ShutdownWarnings) == 0 {
+		cfg.ShutdownWarnings = DefaultShutdownWarnings
+	}
+	m := newMetrics()
+	w := &Watchdog{
+		cfg:       cfg,
+		deps:      deps,
+		logger:    logger,
+		status:    newStatusTracker(&cfg, deps.Clock.Now(), m),
+		lifecycle: NewLifecycle(deps.Clock),
+		sessions:  sessions.NewTracker(cfg.ServerName),
+		metrics:   m,
+	}
+	w.lifecycle.Subscribe(func(event Event) {
+		logger.Info("Lifecycle transition",
+			slog.String("from", string(event.From)),
+			slog.String("to", string(event.To)),
+			slog.String("reason", string(event.Reason)),
+		)
+	})
+	w.lifecycle.Subscribe(w.status.observe)
+	w.lifecycle.Subscribe(m.observeTransition)
+	return w
+}
+
+// Subscribe registers fn to be called for every lifecycle transition.
+func (w *Watchdog) Subscribe(fn func(Event)) {
+	w.lifecycle.Subscribe(fn)
+}
+
+// State returns the current lifecycle state.
+func (w *Watchdog) State() State {
+	return w.lifecycle.State()
+}
+
+// Run executes the watchdog lifecycle until the service has been scaled to zero.
+// If ctx is cancelled, typically because ECS sent SIGTERM, Run performs an
+// emergency drain bounded by StopTimeout instead. Any other error except
+// ErrNoInitialConnection and ErrUncleanShutdown moves the lifecycle to
+// StateFailed.
+func (w *Watchdog) Run(ctx context.Context) error {
+	defer func() {
+		if w.rcon != nil {
+			_ = w.rcon.Close()
+		}
+	}()
+
+	err := w.run(ctx)
+	if ctx.Err() != nil && w.State() != StateStopped {
+		stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), w.cfg.StopTimeout)
+		defer cancel()
+		return w.emergencyStop(stopCtx)
+	}
+	if err != nil && !errors.Is(err, ErrNoInitialConnection) && !errors.Is(err, ErrUncleanShutdown) {
+		w.transition(StateFailed, ReasonError)
+	}
+	return err
+}
+
+func (w *Watchdog) run(ctx context.Context) error {
+	var err error
+	if w.taskARN, err = w.deps.Metadata.TaskARN(ctx); err != nil {
+		return err
+	}
+	publicIP, publicIPv6, err := w.resolvePublicIP(ctx, w.taskARN)
+	if err != nil {
+		return err
+	}
+	// The addresses are recorded before the upsert is sent, as Route53 may
+	// apply it even if the call fails, e.g. when SIGTERM cancels it in flight.
+	// resetDNSRecord then still removes the AAAA record.
+	w.status.update(func(s *serverStatus) {
+		s.PublicIP = publicIP
+		s.PublicIPv6 = publicIPv6
+	})
+	if err := w.updateDNSRecord(ctx, publicIP, publicIPv6); err != nil {
+		return err
+	}
+
+	w.transition(StateWaitingForServer, ReasonDNSPublished)
+	if w.edition, err = w.determineEdition(ctx); err != nil {
+		return err
+	}
+	w.status.update(func(s *serverStatus) { s.Edition = w.edition })
+	if w.edition == EditionJava {
+		if w.rcon, err = w.waitForRCON(ctx); err != nil {
+			return err
+		}
+	}
+	w.transition(StateWaitingForFirstPlayer, ReasonServerReady)
+	w.sendStartupNotification(ctx, publicIP, publicIPv6)
+
+	connected, err := w.waitForInitialClientConnection(ctx)
+	if err != nil {
+		return err
+	}
+	if !connected {
+		w.logger.Info(fmt.Sprintf("%d minutes exceeded without a connection, initiating shutdown.", w.cfg.StartupMin))
+		stopped, err := w.shutdownService(ctx, ReasonStartupTimeout, nil)
+		if err != nil {
+			return err
+		}
+		if stopped {
+			return ErrNoInitialConnection
+		}
+	}
+	return w.monitorClientConnections(ctx)
+}
+
+// determineEdition waits for the server to open its game port. The configured
+// edition is used if set, otherwise it is detected from the listening ports.
+func (w *Watchdog) determineEdition(ctx context.Context) (string, error) {
+	candidates := []string{EditionJava, EditionBedrock}
+	switch w.cfg.Edition {
+	case "":
+		w.logger.Info("Determining Minecraft edition based on listening port...")
+	case EditionJava, EditionBedrock:
+		w.logger.Info("Using configured Minecraft edition", slog.String("edition", w.cfg.Edition))
+		candidates = []string{w.cfg.Edition}
+	default:
+		return "", fmt.Errorf("unknown edition %q, want %s or %s", w.cfg.Edition, EditionJava, EditionBedrock)
+	}
+
+	for counter := 0; counter <= int(maxStartupWait/editionPoll); counter++ {
+		w.logger.Info("Checking ports for Minecraft server availability...",
+			"attempt", counter+1,
+			"javaPort", w.cfg.GamePortFor(EditionJava),
+			"bedrockPort", w.cfg.GamePortFor(EditionBedrock),
+		)
+
+		for _, edition := range candidates {
+			if w.serverListening(edition) {
+				w.logger.Info("Detected Minecraft server on port", "edition", edition, "port", w.cfg.GamePortFor(edition))
+				return edition, nil
+			}
+		}
+
+		if err := w.sleep(ctx, editionPoll); err != nil {
+			return "", err
+		}
+	}
+	return "", errors.New("10 minutes elapsed without Minecraft server starting")
+}
+
+// serverListening reports whether the game port of edition is open. Java is
+// checked for a TCP socket in LISTEN state, Bedrock for any bound UDP socket.
+func (w *Watchdog) serverListening(edition string) bool {
+	if edition == EditionJava {
+		return w.deps.Ports.Listening(w.cfg.GamePortFor(EditionJava))
+	}
+	return w.deps.Ports.Open(w.cfg.GamePortFor(EditionBedrock))
+}
+
+// waitForRCON blocks until RCON accepts an authenticated connection and returns the client.
+func (w *Watchdog) waitForRCON(ctx context.Context) (Commander, error) {
+	if w.cfg.RCONPassword == "" {
+		return nil, errors.New("RCON_PASSWORD is required for Java Edition")
+	}
+
+	w.logger.Info("Waiting for Minecraft RCON to accept authenticated connections...")
+	deadline := w.deps.Clock.Now().Add(maxStartupWait)
+	for w.deps.Clock.Now().Before(deadline) {
+		dialCtx, cancel := context.WithTimeout(ctx, rconDialTimeout)
+		client, err := w.deps.DialRCON(dialCtx)
+		cancel()
+		if err == nil {
+			w.logger.Info("RCON authenticated, ready for clients.")
+			return client, nil
+		}
+		w.metrics.probeFailures.WithLabelValues("rcon").Inc()
+		if isAuthError(err) {
+			return nil, fmt.Errorf("RCON rejected the configured password: %w", err)
+		}
+		if err := w.sleep(ctx, rconWaitInterval); err != nil {
+			return nil, err
+		}
+	}
+	return nil, errors.New("10 minutes elapsed without RCON becoming ready")
+}
+
+func (w *Watchdog) waitForInitialClientConnection(ctx context.Context) (bool, error) {
+	w.logger.Info("Checking every 1 minute for active connections to Minecraft...", slog.Int("minutes", w.cfg.StartupMin))
+	for counter := 0; counter < w.cfg.StartupMin; counter++ {
+		players := w.players(ctx)
+		w.status.setPlayers(players, counter)
+		if players.Online > 0 {
+			w.transition(StateActive, ReasonPlayerJoined)
+			w.logger.Info("Initial connection established, proceeding to shutdown monitoring.",
+				slog.Int("players", players.Online),
+				slog.Any("names", players.Names),
+			)
+			w.learnResolver(ctx)
+			return true, nil
+		}
+		w.logger.Info(fmt.Sprintf("Waiting for connection, minute %d out of %d...", counter, w.cfg.StartupMin))
+		if err := w.sleep(ctx, checkInterval); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func (w *Watchdog) monitorClientConnections(ctx context.Context) error {
+	w.logger.Info("Switching to shutdown monitor.")
+	var lastPlayers []string
+	for {
+		counter := 0
+		for counter <= w.cfg.ShutdownMin {
+			players := w.players(ctx)
+			w.status.setPlayers(players, counter)
+			if players.Online == 0 {
+				w.transition(StateIdle, ReasonPlayersLeft)
+				w.logger.Info(fmt.Sprintf("No active connections, %d out of %d minutes", counter, w.cfg.ShutdownMin))
+				counter++
+			} else {
+				w.transition(StateActive, ReasonPlayerJoined)
+				w.logger.Info("Active connections detected, resetting counter.",
+					slog.Int("players", players.Online),
+					slog.Any("names", players.Names),
+				)
+				if len(players.Names) > 0 {
+					lastPlayers = players.Names
+				}
+				counter = 0
+			}
+			if err := w.sleep(ctx, checkInterval); err != nil {
+				return err
+			}
+		}
+		w.logger.Info(fmt.Sprintf("%d minutes elapsed without a connection, terminating.", w.cfg.ShutdownMin))
+		stopped, err := w.shutdownService(ctx, ReasonIdleTimeout, lastPlayers)
+		if err != nil || stopped {
+			return err
+		}
+		w.logger.Info("Shutdown aborted, resuming shutdown monitor.")
+	}
+}
+
+// shutdownService drains the server and scales the service to zero. It returns
+// false if a player joined during the drain and the shutdown was aborted. A
+// drain that did not stop the server cleanly is reported as an unexpected stop
+// and returned as an error wrapping ErrUncleanShutdown once scaled down.
+func (w *Watchdog) shutdownService(ctx context.Context, reason Reason, lastPlayers []string) (bool, error) {
+	w.transition(StateDraining, reason)
+	steps, ok, err := w.drainServer(ctx)
+	if errors.Is(err, ErrUncleanShutdown) {
+		return true, w.forceShutdown(ctx, err, lastPlayers, steps)
+	}
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		w.transition(StateActive, ReasonPlayerJoined)
+		return false, nil
+	}
+
+	// A failed DNS reset is reported but does not keep the server running.
+	if err := w.resetDNSRecord(ctx); err != nil {
+		w.logger.Error("Failed to reset DNS record", slog.String("error", err.Error()))
+		steps = append(steps, "Failed to reset DNS record: "+err.Error())
+	} else {
+		steps = append(steps, fmt.Sprintf("DNS record reset to %s", w.cfg.DNSParkingIP))
+	}
+
+	w.endSessions(ctx)
+	w.sendShutdownNotification(ctx, lastPlayers, steps)
+	if err := w.scaleDown(ctx); err != nil {
+		return false, err
+	}
+	w.transition(StateStopped, ReasonScaledDown)
+	w.logger.Info("Service shutdown initiated")
+	return true, nil
+}
+
+// forceShutdown scales the service to zero after a drain that failed with
+// drainErr. The world may not have been saved, so it is reported like an
+// emergency stop rather than a regular shutdown.
+func (w *Watchdog) forceShutdown(ctx context.Context, drainErr error, lastPlayers, steps []string) error {
+	w.logger.Error("Server did not shut down cleanly, scaling down anyway", slog.String("error", drainErr.Error()))
+	if err := w.resetDNSRecord(ctx); err != nil {
+		w.logger.Error("Failed to reset DNS record", slog.String("error", err.Error()))
+		steps = append(steps, "Failed to reset DNS record: "+err.Error())
+	} else {
+		steps = append(steps, fmt.Sprintf("DNS record reset to %s", w.cfg.DNSParkingIP))
+	}
+
+	w.endSessions(ctx)
+	w.sendUnexpectedStopNotification(ctx, "Server did not shut down cleanly.", drainErr.Error(), lastPlayers, steps)
+	if err := w.scaleDown(ctx); err != nil {
+		return err
+	}
+	w.transition(StateStopped, ReasonUncleanStop)
+	w.logger.Info("Service shutdown initiated")
+	return drainErr
+}
+
+// players probes the server for the configured edition. Probe errors are
+// logged, counted and reported as no players online.
+func (w *Watchdog) players(ctx context.Context) PlayerStatus {
+	probe := w.deps.Bedrock
+	if w.edition == EditionJava {
+		probe = w.deps.Java
+	}
+	players, err := probe.Players(ctx)
+	if err != nil {
+		w.metrics.probeFailures.WithLabelValues(w.edition).Inc()
+		w.logger.Error("Failed to probe players", slog.String("edition", w.edition), slog.String("error", err.Error()))
+		return PlayerStatus{}
+	}
+
+	// The status ping only carries a sample of up to 12 names, RCON list
+	// returns all of them. Sessions are only tracked from the full list, a
+	// sample would end the sessions of everyone it leaves out.
+	if w.rcon == nil {
+		w.trackSessions(ctx, players)
+		return players
+	}
+	list, err := w.rcon.List(ctx)
+	if err != nil {
+		w.metrics.probeFailures.WithLabelValues("rcon").Inc()
+		w.logger.Error("Failed to list players over RCON, not updating sessions", slog.String("error", err.Error()))
+		return players
+	}
+	players.Online = list.Online
+	players.Names = list.Names
+	w.trackSessions(ctx, players)
+	return players
+}
+
+// learnResolver remembers the resolver whose query woke the server, so the
+// launcher accepts it even if it matches none of the allow rules.
+func (w *Watchdog) learnResolver(ctx context.Context) {
+	if w.deps.Resolvers == nil {
+		return
+	}
+	since := w.status.snapshot().StartedAt.Add(-resolverWakeWindow)
+	resolver, err := w.deps.Resolvers.LearnLastWake(ctx, since, w.deps.Clock.Now())
+	if err != nil {
+		w.logger.Error("Failed to learn resolver", slog.String("error", err.Error()))
+		return
+	}
+	if resolver.IsValid() {
+		w.logger.Info("Learned resolver of the wakeup", slog.String("resolver", resolver.String()))
+	}
+}
+
+// transition moves the lifecycle to the state to. Invalid transitions indicate
+// a bug in the watchdog and are logged rather than aborting the run.
+func (w *Watchdog) transition(to State, reason Reason) {
+	if err := w.lifecycle.Transition(to, reason); err != nil {
+		w.logger.Error("Lifecycle transition rejected", slog.String("error", err.Error()))
+	}
+}
+
+// sleep waits for d on the injected clock or until ctx is done.
+func (w *Watchdog) sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-w.deps.Clock.After(d):
+		return nil
+	}
+}
@@ -0,0 +1,583 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/rcon"
+	"github.com/cbrgm/cdk-on-demand-minecraft-server/internal/sessions"
+)
+
+var startTime = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// fakeClock advances instantly by every duration waited for. Once frozen, it
+// never fires again, so a cancelled context always wins a sleep.
+type fakeClock struct {
+	now    time.Time
+	frozen bool
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	if c.frozen {
+		return ch
+	}
+	c.now = c.now.Add(d)
+	ch <- c.now
+	return ch
+}
+
+// minute returns the time m minutes after startTime.
+func minute(m float64) time.Time {
+	return startTime.Add(time.Duration(m * float64(time.Minute)))
+}
+
+type fakeECS struct {
+	stoppedReason string
+	updates       []*ecs.UpdateServiceInput
+}
+
+func (f *fakeECS) DescribeTasks(context.Context, *ecs.DescribeTasksInput, ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+	return &ecs.DescribeTasksOutput{Tasks: []ecstypes.Task{{
+		Attachments: []ecstypes.Attachment{{Details: []ecstypes.KeyValuePair{
+			{Name: aws.String("networkInterfaceId"), Value: aws.String("eni-0123")},
+		}}},
+		StoppedReason: aws.String(f.stoppedReason),
+	}}}, nil
+}
+
+func (f *fakeECS) UpdateService(_ context.Context, params *ecs.UpdateServiceInput, _ ...func(*ecs.Options)) (*ecs.UpdateServiceOutput, error) {
+	f.updates = append(f.updates, params)
+	return &ecs.UpdateServiceOutput{}, nil
+}
+
+// scaledDown reports whether the service was scaled to zero.
+func (f *fakeECS) scaledDown() bool {
+	return slices.ContainsFunc(f.updates, func(in *ecs.UpdateServiceInput) bool {
+		return in.DesiredCount != nil && *in.DesiredCount == 0
+	})
+}
+
+// fakeEC2 returns the task's public IPv4 and, if set, its IPv6 address.
+type fakeEC2 struct {
+	ipv6 string
+}
+
+func (f *fakeEC2) DescribeNetworkInterfaces(context.Context, *ec2.DescribeNetworkInterfacesInput, ...func(*ec2.Options)) (*ec2.DescribeNetworkInterfacesOutput, error) {
+	iface := ec2types.NetworkInterface{
+		Association: &ec2types.NetworkInterfaceAssociation{PublicIp: aws.String("203.0.113.10")},
+	}
+	if f.ipv6 != "" {
+		iface.Ipv6Addresses = []ec2types.NetworkInterfaceIpv6Address{{Ipv6Address: aws.String(f.ipv6)}}
+	}
+	return &ec2.DescribeNetworkInterfacesOutput{NetworkInterfaces: []ec2types.NetworkInterface{iface}}, nil
+}
+
+// fakeRoute53 keeps the records of the hosted zone. Like Route53, it rejects
+// a whole batch that deletes a missing record.
+type fakeRoute53 struct {
+	// values lists every A record value set.
+	values  []string
+	records map[types.RRType]string
+	// onChange is called with every applied batch, its error is returned
+	// after the batch was applied.
+	onChange func(changes []types.Change) error
+	// failNext fails the next batch before it is applied.
+	failNext error
+}
+
+func (f *fakeRoute53) ChangeResourceRecordSets(_ context.Context, params *route53.ChangeResourceRecordSetsInput, _ ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error) {
+	if err := f.failNext; err != nil {
+		f.failNext = nil
+		return nil, err
+	}
+	changes := params.ChangeBatch.Changes
+	for _, change := range changes {
+		if _, ok := f.records[change.ResourceRecordSet.Type]; change.Action == types.ChangeActionDelete && !ok {
+			return nil, &types.InvalidChangeBatch{Message: aws.String("record not found")}
+		}
+	}
+	if f.records == nil {
+		f.records = make(map[types.RRType]string)
+	}
+	for _, change := range changes {
+		rrType := change.ResourceRecordSet.Type
+		value := aws.ToString(change.ResourceRecordSet.ResourceRecords[0].Value)
+		if change.Action == types.ChangeActionDelete {
+			delete(f.records, rrType)
+			continue
+		}
+		f.records[rrType] = value
+		if rrType == types.RRTypeA {
+			f.values = append(f.values, value)
+		}
+	}
+	if f.onChange != nil {
+		if err := f.onChange(changes); err != nil {
+			return nil, err
+		}
+	}
+	return &route53.ChangeResourceRecordSetsOutput{ChangeInfo: &types.ChangeInfo{Id: aws.String("C123")}}, nil
+}
+
+func (f *fakeRoute53) GetChange(context.Context, *route53.GetChangeInput, ...func(*route53.Options)) (*route53.GetChangeOutput, error) {
+	return &route53.GetChangeOutput{ChangeInfo: &types.ChangeInfo{Id: aws.String("C123"), Status: types.ChangeStatusInsync}}, nil
+}
+
+type fakeMetadata struct{}
+
+func (fakeMetadata) TaskARN(context.Context) (string, error) {
+	return "arn:aws:ecs:eu-west-1:123456789012:task/minecraft/0123", nil
+}
+
+// fakeServer is a Java server answering the status ping, RCON and port
+// probes. online decides who is playing at a given time.
+type fakeServer struct {
+	clock  *fakeClock
+	online func(now time.Time) []string
+	// onSay is called for every broadcast message.
+	onSay func(message string)
+	// ignoreStop keeps the server running after the stop command.
+	ignoreStop bool
+	// listErr fails the RCON list command.
+	listErr error
+
+	said    []string
+	saves   int
+	stops   int
+	stopped bool
+}
+
+func (s *fakeServer) names() []string {
+	if s.online == nil {
+		return nil
+	}
+	return s.online(s.clock.Now())
+}
+
+// Players answers the status ping, which like vanilla servers only samples
+// up to 12 names.
+func (s *fakeServer) Players(context.Context) (PlayerStatus, error) {
+	names := s.names()
+	return PlayerStatus{Online: len(names), Max: 20, Names: names[:min(len(names), 12)], Version: "1.21.1"}, nil
+}
+
+func (s *fakeServer) List(context.Context) (rcon.PlayerList, error) {
+	if s.listErr != nil {
+		return rcon.PlayerList{}, s.listErr
+	}
+	names := s.names()
+	return rcon.PlayerList{Online: len(names), Max: 20, Names: names}, nil
+}
+
+func (s *fakeServer) Say(_ context.Context, message string) error {
+	s.said = append(s.said, message)
+	if s.onSay != nil {
+		s.onSay(message)
+	}
+	return nil
+}
+
+func (s *fakeServer) SaveAll(context.Context) error {
+	s.saves++
+	return nil
+}
+
+func (s *fakeServer) Stop(context.Context) error {
+	s.stops++
+	s.stopped = !s.ignoreStop
+	return nil
+}
+
+func (s *fakeServer) Close() error { return nil }
+
+func (s *fakeServer) Listening(int) bool { return !s.stopped }
+
+func (s *fakeServer) Open(port int) bool { return s.Listening(port) }
+
+// saidContaining returns the number of broadcasts containing substr.
+func (s *fakeServer) saidContaining(substr string) int {
+	n := 0
+	for _, message := range s.said {
+		if strings.Contains(message, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+type fakeSessionStore struct {
+	sessions []sessions.Session
+}
+
+func (f *fakeSessionStore) Append(_ context.Context, session sessions.Session) error {
+	f.sessions = append(f.sessions, session)
+	return nil
+}
+
+type harness struct {
+	clock    *fakeClock
+	ecs      *fakeECS
+	ec2      *fakeEC2
+	route53  *fakeRoute53
+	server   *fakeServer
+	sessions *fakeSessionStore
+	events   []Event
+	w        *Watchdog
+}
+
+func newHarness(t *testing.T, online func(now time.Time) []string) *harness {
+	t.Helper()
+	h := &harness{
+		clock:    &fakeClock{now: startTime},
+		ecs:      &fakeECS{stoppedReason: "Task stopped by user"},
+		ec2:      &fakeEC2{},
+		route53:  &fakeRoute53{},
+		sessions: &fakeSessionStore{},
+	}
+	h.server = &fakeServer{clock: h.clock, online: online}
+
+	cfg := Config{
+		Cluster:           "minecraft",
+		Service:           "minecraft-server",
+		ServerName:        "mc.example.com",
+		DNSZone:           "Z123",
+		DNSParkingIP:      "192.168.1.1",
+		StartupMin:        3,
+		ShutdownMin:       5,
+		RCONPassword:      "secret",
+		Edition:           EditionJava,
+		ShutdownWarnings:  []time.Duration{time.Minute, 10 * time.Second},
+		ServerStopTimeout: time.Minute,
+		StopTimeout:       time.Minute,
+	}
+	h.w = New(cfg, Deps{
+		ECS:      h.ecs,
+		EC2:      h.ec2,
+		Route53:  h.route53,
+		Clock:    h.clock,
+		Metadata: fakeMetadata{},
+		Ports:    h.server,
+		Java:     h.server,
+		Bedrock:  h.server,
+		DialRCON: func(context.Context) (Commander, error) { return h.server, nil },
+		Sessions: h.sessions,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	h.w.Subscribe(func(event Event) { h.events = append(h.events, event) })
+	return h
+}
+
+// transitioned reports whether the lifecycle moved from one state to another.
+func (h *harness) transitioned(from, to State) bool {
+	return slices.ContainsFunc(h.events, func(event Event) bool {
+		return event.From == from && event.To == to
+	})
+}
+
+// drainStartedAt returns when the first shutdown drain began.
+func (h *harness) drainStartedAt(t *testing.T) time.Time {
+	t.Helper()
+	for _, event := range h.events {
+		if event.To == StateDraining {
+			return event.At
+		}
+	}
+	t.Fatal("watchdog never started draining")
+	return time.Time{}
+}
+
+// assertScaledDown checks that the server was stopped cleanly, the DNS record
+// parked and the service scaled to zero.
+func (h *harness) assertScaledDown(t *testing.T) {
+	t.Helper()
+	if got := h.w.State(); got != StateStopped {
+		t.Errorf("state = %s, want %s", got, StateStopped)
+	}
+	if h.server.saves != 1 || h.server.stops != 1 {
+		t.Errorf("server saved %d and stopped %d times, want once each", h.server.saves, h.server.stops)
+	}
+	if !h.ecs.scaledDown() {
+		t.Error("service was not scaled to zero")
+	}
+	if got, want := h.route53.values, []string{"203.0.113.10", "192.168.1.1"}; !slices.Equal(got, want) {
+		t.Errorf("A record values = %q, want %q", got, want)
+	}
+}
+
+// onlineBetween returns an online func with name playing in [from, to).
+func onlineBetween(name string, from, to time.Time) func(time.Time) []string {
+	return func(now time.Time) []string {
+		if !now.Before(from) && now.Before(to) {
+			return []string{name}
+		}
+		return nil
+	}
+}
+
+func TestRunNobodyJoins(t *testing.T) {
+	h := newHarness(t, nil)
+
+	err := h.w.Run(context.Background())
+	if !errors.Is(err, ErrNoInitialConnection) {
+		t.Fatalf("Run() error = %v, want %v", err, ErrNoInitialConnection)
+	}
+	h.assertScaledDown(t)
+	if h.transitioned(StateWaitingForFirstPlayer, StateActive) {
+		t.Error("watchdog saw a player that never joined")
+	}
+	if got, want := h.drainStartedAt(t), minute(3); !got.Equal(want) {
+		t.Errorf("drain started at %s, want after StartupMin at %s", got, want)
+	}
+	for _, warning := range []string{"1 minute", "10 seconds"} {
+		if h.server.saidContaining("shutting down in "+warning) != 1 {
+			t.Errorf("warning %q not announced, said %q", warning, h.server.said)
+		}
+	}
+}
+
+func TestRunShutdownAfterIdle(t *testing.T) {
+	h := newHarness(t, onlineBetween("alice", minute(1), minute(4)))
+
+	if err := h.w.Run(context.Background()); err != nil {
+		t.Fatalf("Run(): %v", err)
+	}
+	h.assertScaledDown(t)
+	if !h.transitioned(StateActive, StateIdle) {
+		t.Error("watchdog never went idle")
+	}
+	// alice is last seen at minute 3, the counter runs to ShutdownMin
+	// inclusive once she is gone.
+	if got, want := h.drainStartedAt(t), minute(4+5+1); !got.Equal(want) {
+		t.Errorf("drain started at %s, want %s", got, want)
+	}
+}
+
+func TestRunIdleTimerResetsOnRejoin(t *testing.T) {
+	first := onlineBetween("alice", minute(1), minute(3))
+	rejoin := onlineBetween("alice", minute(6), minute(7))
+	h := newHarness(t, func(now time.Time) []string {
+		return append(first(now), rejoin(now)...)
+	})
+
+	if err := h.w.Run(context.Background()); err != nil {
+		t.Fatalf("Run(): %v", err)
+	}
+	h.assertScaledDown(t)
+	if !h.transitioned(StateIdle, StateActive) {
+		t.Error("rejoin did not reactivate the watchdog")
+	}
+	// Without the reset the drain would start ShutdownMin after minute 3.
+	if got, want := h.drainStartedAt(t), minute(7+5+1); !got.Equal(want) {
+		t.Errorf("drain started at %s, want %s", got, want)
+	}
+}
+
+func TestRunDrainAbortedByJoin(t *testing.T) {
+	var joinAt time.Time
+	h := newHarness(t, func(now time.Time) []string {
+		switch {
+		case !now.Before(minute(1)) && now.Before(minute(2)):
+			return []string{"alice"}
+		case !joinAt.IsZero() && !now.Before(joinAt) && now.Before(joinAt.Add(2*time.Minute)):
+			return []string{"bob"}
+		}
+		return nil
+	})
+	h.server.onSay = func(message string) {
+		if joinAt.IsZero() && strings.Contains(message, "shutting down in 1 minute") {
+			joinAt = h.clock.Now().Add(20 * time.Second)
+		}
+	}
+
+	if err := h.w.Run(context.Background()); err != nil {
+		t.Fatalf("Run(): %v", err)
+	}
+	if h.server.saidContaining("Shutdown aborted") != 1 {
+		t.Errorf("abort not announced, said %q", h.server.said)
+	}
+	if !h.transitioned(StateDraining, StateActive) {
+		t.Error("join during the drain did not reactivate the watchdog")
+	}
+	if got := h.server.saidContaining("shutting down in 1 minute"); got != 2 {
+		t.Errorf("first warning announced %d times, want once per drain", got)
+	}
+	// The aborted drain neither saved nor stopped the server.
+	h.assertScaledDown(t)
+}
+
+func TestRunUncleanShutdown(t *testing.T) {
+	h := newHarness(t, onlineBetween("alice", minute(1), minute(2)))
+	h.server.ignoreStop = true
+
+	err := h.w.Run(context.Background())
+	if !errors.Is(err, ErrUncleanShutdown) {
+		t.Fatalf("Run() error = %v, want %v", err, ErrUncleanShutdown)
+	}
+	if got := h.w.State(); got != StateStopped {
+		t.Errorf("state = %s, want %s", got, StateStopped)
+	}
+	if !h.ecs.scaledDown() {
+		t.Error("service was not scaled to zero")
+	}
+	last := h.events[len(h.events)-1]
+	if last.Reason != ReasonUncleanStop {
+		t.Errorf("last transition reason = %s, want %s", last.Reason, ReasonUncleanStop)
+	}
+}
+
+func TestRunSIGTERM(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h := newHarness(t, nil)
+	h.server.online = func(now time.Time) []string {
+		if !now.Before(minute(2)) {
+			// ECS stops the task while alice is playing.
+			h.clock.frozen = true
+			cancel()
+		}
+		return []string{"alice"}
+	}
+
+	if err := h.w.Run(ctx); err != nil {
+		t.Fatalf("Run(): %v", err)
+	}
+	if got := h.w.State(); got != StateStopped {
+		t.Errorf("state = %s, want %s", got, StateStopped)
+	}
+	if !h.transitioned(StateActive, StateDraining) {
+		t.Error("watchdog did not drain from the active state")
+	}
+	last := h.events[len(h.events)-1]
+	if last.Reason != ReasonTerminated {
+		t.Errorf("last transition reason = %s, want %s", last.Reason, ReasonTerminated)
+	}
+	if h.server.saidContaining("stopped by the host") != 1 {
+		t.Errorf("players not warned, said %q", h.server.said)
+	}
+	if h.server.saves != 1 {
+		t.Errorf("world saved %d times, want 1", h.server.saves)
+	}
+	if h.server.stops != 0 {
+		t.Error("emergency stop sent the stop command, ECS stops the server")
+	}
+	if h.ecs.scaledDown() {
+		t.Error("emergency stop scaled the service down")
+	}
+	if got := h.route53.values; len(got) == 0 || got[len(got)-1] != "192.168.1.1" {
+		t.Errorf("A record values = %q, want the parking IP last", got)
+	}
+}
+
+func TestNewDefaultsEmptyShutdownWarnings(t *testing.T) {
+	h := newHarness(t, nil)
+	cfg := h.w.cfg
+	cfg.ShutdownWarnings = []time.Duration{}
+
+	w := New(cfg, h.w.deps, h.w.logger)
+	if !slices.Equal(w.cfg.ShutdownWarnings, DefaultShutdownWarnings) {
+		t.Fatalf("ShutdownWarnings = %v, want %v", w.cfg.ShutdownWarnings, DefaultShutdownWarnings)
+	}
+}
+
+func TestPlayersTracksSessionsFromFullList(t *testing.T) {
+	var names []string
+	for i := range 13 {
+		names = append(names, fmt.Sprintf("player%02d", i))
+	}
+	online := names
+	h := newHarness(t, func(time.Time) []string { return online })
+	h.w.edition = EditionJava
+	h.w.rcon = h.server
+
+	h.w.players(context.Background())
+
+	// RCON fails and only the sample of 12 names is left.
+	h.clock.now = minute(1)
+	h.server.listErr = errors.New("connection reset")
+	if got := h.w.players(context.Background()); got.Online != 13 {
+		t.Fatalf("players().Online = %d, want 13", got.Online)
+	}
+	if len(h.sessions.sessions) != 0 {
+		t.Fatalf("sample ended %d sessions, want none", len(h.sessions.sessions))
+	}
+
+	h.clock.now = minute(2)
+	h.server.listErr = nil
+	online = nil
+	h.w.players(context.Background())
+	if got := len(h.sessions.sessions); got != 13 {
+		t.Fatalf("%d sessions ended, want 13", got)
+	}
+	for _, session := range h.sessions.sessions {
+		if session.Duration() != 2*time.Minute {
+			t.Errorf("session of %s lasted %s, want 2m", session.Player, session.Duration())
+		}
+	}
+}
+
+func TestRunSIGTERMDuringDNSUpsert(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h := newHarness(t, nil)
+	h.ec2.ipv6 = "2001:db8::10"
+	h.route53.onChange = func([]types.Change) error {
+		// ECS stops the task after Route53 applied the upsert, but before
+		// the response arrived.
+		h.route53.onChange = nil
+		cancel()
+		return context.Canceled
+	}
+
+	if err := h.w.Run(ctx); err != nil {
+		t.Fatalf("Run(): %v", err)
+	}
+	if got := h.w.State(); got != StateStopped {
+		t.Errorf("state = %s, want %s", got, StateStopped)
+	}
+	if got, ok := h.route53.records[types.RRTypeAaaa]; ok {
+		t.Errorf("AAAA record still points to %s, want it deleted", got)
+	}
+	if got := h.route53.records[types.RRTypeA]; got != "192.168.1.1" {
+		t.Errorf("A record = %s, want the parking IP", got)
+	}
+}
+
+func TestRunSIGTERMBeforeDNSUpsert(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h := newHarness(t, nil)
+	h.ec2.ipv6 = "2001:db8::10"
+	// The upsert is cancelled before Route53 applied it, so there is no AAAA
+	// record to delete.
+	cancel()
+	h.route53.failNext = context.Canceled
+
+	if err := h.w.Run(ctx); err != nil {
+		t.Fatalf("Run(): %v", err)
+	}
+	if got := h.route53.records[types.RRTypeA]; got != "192.168.1.1" {
+		t.Errorf("A record = %s, want the parking IP", got)
+	}
+	if _, ok := h.route53.records[types.RRTypeAaaa]; ok {
+		t.Error("AAAA record published")
+	}
+}